@@ -3,6 +3,8 @@ package main
 
 import (
     "bufio"
+    "bytes"
+    "embed"
     "encoding/json"
     "errors"
     "fmt"
@@ -11,6 +13,8 @@ import (
     "math/rand"
     "os"
     "path/filepath"
+    "reflect"
+    "slices"
     "sort"
     "strconv"
     "strings"
@@ -31,6 +35,31 @@ const (
     zoneMacron  = "zone_macron"
 )
 
+// Etape minimale de l'histoire, ecrite par son nom dans les fichiers de contenu
+type storyStage int
+
+var stageIDs = map[string]storyStage{
+    "prologue": stagePrologue,
+    "artists":  stageArtists,
+    "macron":   stageMacron,
+    "label":    stageLabel,
+    "finish":   stageFinish,
+}
+
+// Lit une etape nommee ("artists", "label"...) et refuse les noms inconnus
+func (s *storyStage) UnmarshalJSON(data []byte) error {
+    var id string
+    if err := json.Unmarshal(data, &id); err != nil {
+        return fmt.Errorf("etape attendue par son nom (prologue, artists, macron, label, finish): %s", data)
+    }
+    stage, ok := stageIDs[id]
+    if !ok {
+        return fmt.Errorf("etape inconnue %q", id)
+    }
+    *s = stage
+    return nil
+}
+
 type ItemType string
 
 type EnemyType string
@@ -58,8 +87,271 @@ type ItemDefinition struct {
     Description  string
     Type         ItemType
     Price        int
-    EffectID     string
     BetPointCost int
+    Sold         bool
+    Target       string
+    Effects      []EffectStep
+    Slot         string
+    MaxHPBonus   int
+    MaxManaBonus int
+    StackMax     int
+    MinStage     storyStage
+    Zone         string
+    Stock        int
+    FameTier     int
+    UpgradeWith  string
+}
+
+// Niveau d'amelioration maximal d'un objet
+const maxUpgrade = 5
+
+// Pile d'objets identiques (meme niveau d'amelioration) occupant un emplacement de sacoche
+type ItemStack struct {
+    ID      string
+    Qty     int
+    Upgrade int
+    Rarity  string
+    Affixes []Affix
+}
+
+// Sacoche d'un personnage: une pile par emplacement
+type Inventory []ItemStack
+
+// Accepte aussi l'ancien format de sauvegarde (liste d'identifiants)
+func (inv *Inventory) UnmarshalJSON(data []byte) error {
+    var stacks []ItemStack
+    if err := json.Unmarshal(data, &stacks); err == nil {
+        *inv = stacks
+        return nil
+    }
+    var ids []string
+    if err := json.Unmarshal(data, &ids); err != nil {
+        return err
+    }
+    out := Inventory{}
+    for _, id := range ids {
+        out.add(id, 1)
+    }
+    *inv = out
+    return nil
+}
+
+// Nombre maximal d'exemplaires par pile
+func stackLimit(id string) int {
+    def := items[id]
+    if def.StackMax > 0 {
+        return def.StackMax
+    }
+    switch def.Type {
+    case itemConsumable:
+        return 10
+    case itemMaterial:
+        return 20
+    case itemBoost:
+        return 5
+    default:
+        return 1
+    }
+}
+
+// Nombre total d'exemplaires d'un objet
+func (inv Inventory) count(id string) int {
+    total := 0
+    for _, st := range inv {
+        if st.ID == id {
+            total += st.Qty
+        }
+    }
+    return total
+}
+
+// Indique si qty exemplaires tiennent dans la sacoche sans depasser slots piles
+func (inv Inventory) canAdd(id string, qty, slots int) bool {
+    return inv.fits(ItemStack{ID: id, Qty: qty}, slots)
+}
+
+// Indique si une pile (avec son niveau) tient dans la sacoche
+func (inv Inventory) fits(add ItemStack, slots int) bool {
+    limit := stackLimit(add.ID)
+    qty := add.Qty
+    for _, st := range inv {
+        if sameKind(st, add) && st.Qty < limit {
+            qty -= limit - st.Qty
+        }
+    }
+    if qty <= 0 {
+        return true
+    }
+    return (slots-len(inv))*limit >= qty
+}
+
+// Indique si deux piles peuvent fusionner (meme objet, meme niveau, sans rarete tiree)
+func sameKind(a, b ItemStack) bool {
+    return a.ID == b.ID && a.Upgrade == b.Upgrade && a.Rarity == b.Rarity && len(a.Affixes) == 0 && len(b.Affixes) == 0
+}
+
+// Ajoute des exemplaires en completant les piles existantes (place a verifier avant)
+func (inv *Inventory) add(id string, qty int) {
+    inv.put(ItemStack{ID: id, Qty: qty})
+}
+
+// Range une pile en la fusionnant avec celles du meme objet et du meme niveau
+func (inv *Inventory) put(add ItemStack) {
+    limit := stackLimit(add.ID)
+    qty := add.Qty
+    for i := range *inv {
+        if qty <= 0 {
+            return
+        }
+        st := &(*inv)[i]
+        if !sameKind(*st, add) || st.Qty >= limit {
+            continue
+        }
+        room := min(limit-st.Qty, qty)
+        st.Qty += room
+        qty -= room
+    }
+    for qty > 0 {
+        n := min(qty, limit)
+        st := add
+        st.Qty = n
+        *inv = append(*inv, st)
+        qty -= n
+    }
+}
+
+// Indique si la pile est un exemplaire de base (sans amelioration, rarete ni affixe)
+func (st ItemStack) basic() bool {
+    return st.Upgrade == 0 && rarityOf(st.Rarity).ID == rarityCommon && len(st.Affixes) == 0
+}
+
+// Retire qty exemplaires en partant des dernieres piles, les exemplaires de base avant les ameliores ou rares
+func (inv *Inventory) remove(id string, qty int) bool {
+    if inv.count(id) < qty {
+        return false
+    }
+    for _, basicOnly := range []bool{true, false} {
+        for i := len(*inv) - 1; i >= 0 && qty > 0; i-- {
+            st := &(*inv)[i]
+            if st.ID != id || (basicOnly && !st.basic()) {
+                continue
+            }
+            take := min(st.Qty, qty)
+            st.Qty -= take
+            qty -= take
+            if st.Qty == 0 {
+                *inv = append((*inv)[:i], (*inv)[i+1:]...)
+            }
+        }
+    }
+    return true
+}
+
+// Retire un exemplaire de la pile a l'indice donne
+func (inv *Inventory) takeAt(idx int) ItemStack {
+    return inv.takeQty(idx, 1)
+}
+
+// Retire qty exemplaires de la pile a l'indice donne en gardant leur niveau
+func (inv *Inventory) takeQty(idx, qty int) ItemStack {
+    st := &(*inv)[idx]
+    qty = min(qty, st.Qty)
+    out := *st
+    out.Qty = qty
+    st.Qty -= qty
+    if st.Qty <= 0 {
+        *inv = append((*inv)[:idx], (*inv)[idx+1:]...)
+    }
+    return out
+}
+
+// Ordre d'affichage des types d'objets
+var itemTypeOrder = []ItemType{itemConsumable, itemBoost, itemEquipment, itemSpecial, itemMaterial}
+
+var itemTypeNames = map[ItemType]string{
+    itemConsumable: "Consommables",
+    itemBoost:      "Boosts",
+    itemEquipment:  "Equipements",
+    itemSpecial:    "Objets speciaux",
+    itemMaterial:   "Materiaux",
+}
+
+// Types d'objets utilisables pendant un combat
+var combatItemTypes = []ItemType{itemConsumable, itemBoost}
+
+func typeRank(t ItemType) int {
+    for i, it := range itemTypeOrder {
+        if it == t {
+            return i
+        }
+    }
+    return len(itemTypeOrder)
+}
+
+// Trie la sacoche par type ("type") ou par nom ("name")
+func (inv Inventory) sortBy(mode string) {
+    sort.SliceStable(inv, func(i, j int) bool {
+        a, b := items[inv[i].ID], items[inv[j].ID]
+        if mode == "type" && a.Type != b.Type {
+            return typeRank(a.Type) < typeRank(b.Type)
+        }
+        return a.Name < b.Name
+    })
+}
+
+// Indices des piles dont le type fait partie du filtre (tous si filtre vide)
+func (inv Inventory) filter(types ...ItemType) []int {
+    out := []int{}
+    for i, st := range inv {
+        if len(types) == 0 {
+            out = append(out, i)
+            continue
+        }
+        for _, t := range types {
+            if items[st.ID].Type == t {
+                out = append(out, i)
+                break
+            }
+        }
+    }
+    return out
+}
+
+// Nom affichable d'une pile ("Potion de vie x3", "Disque Loup +2")
+func stackLabel(st ItemStack) string {
+    name := st.ID
+    if def, ok := items[st.ID]; ok {
+        name = def.Name
+    }
+    if st.Upgrade > 0 {
+        name += fmt.Sprintf(" +%d", st.Upgrade)
+    }
+    if tier := rarityOf(st.Rarity); tier.Color != "" {
+        name = fmt.Sprintf("%s%s [%s]%s", tier.Color, name, tier.ID, colorReset)
+    }
+    if st.Qty > 1 {
+        return fmt.Sprintf("%s x%d", name, st.Qty)
+    }
+    return name
+}
+
+const (
+    slotHead      = "head"
+    slotBody      = "body"
+    slotFeet      = "feet"
+    slotHands     = "hands"
+    slotAccessory = "accessory"
+)
+
+// Emplacements d'equipement dans l'ordre d'affichage
+var equipSlots = []string{slotHead, slotBody, slotFeet, slotHands, slotAccessory}
+
+var slotNames = map[string]string{
+    slotHead:      "Tete",
+    slotBody:      "Corps",
+    slotFeet:      "Pieds",
+    slotHands:     "Mains",
+    slotAccessory: "Accessoire",
 }
 
 // Recette permettant de fabriquer un objet
@@ -69,6 +361,396 @@ type RecipeDefinition struct {
     Inputs    []string
     OutputID  string
     CraftCost int
+    Hidden    bool
+    Skill     int
+    Hint      string
+}
+
+// Pieces portees par emplacement
+type Gear map[string]ItemStack
+
+// Accepte aussi l'ancien format de sauvegarde (emplacement -> identifiant)
+func (gear *Gear) UnmarshalJSON(data []byte) error {
+    var stacks map[string]ItemStack
+    if err := json.Unmarshal(data, &stacks); err == nil {
+        *gear = stacks
+        return nil
+    }
+    var ids map[string]string
+    if err := json.Unmarshal(data, &ids); err != nil {
+        return err
+    }
+    out := Gear{}
+    for slot, id := range ids {
+        out[slot] = ItemStack{ID: id, Qty: 1}
+    }
+    *gear = out
+    return nil
+}
+
+// Palier de bonus d'un ensemble, actif a partir de Count pieces portees
+type SetTier struct {
+    Count        int
+    MaxHP        int
+    MaxMana      int
+    Attack       int
+    NoteDiscount int
+    StartShield  int
+}
+
+// Ensemble d'equipement nomme et ses paliers
+type ItemSet struct {
+    ID     string
+    Name   string
+    Pieces []string
+    Tiers  []SetTier
+}
+
+// Ensembles d'equipement (charges depuis data/sets.json)
+var itemSets []ItemSet
+
+// Liste les incoherences d'un ensemble
+func checkItemSet(set ItemSet, catalog map[string]ItemDefinition) []string {
+    problems := []string{}
+    if set.Name == "" {
+        problems = append(problems, "nom manquant")
+    }
+    if len(set.Pieces) < 2 {
+        problems = append(problems, "un ensemble compte au moins 2 pieces")
+    }
+    for _, id := range set.Pieces {
+        if def, ok := catalog[id]; !ok || def.Slot == "" {
+            problems = append(problems, fmt.Sprintf("piece inconnue ou non equipable %q", id))
+        }
+    }
+    for _, tier := range set.Tiers {
+        if tier.Count < 2 || tier.Count > len(set.Pieces) {
+            problems = append(problems, fmt.Sprintf("palier a %d pieces impossible", tier.Count))
+        }
+    }
+    return problems
+}
+
+// Nom de l'ensemble auquel appartient un objet (vide sinon)
+func setOf(id string) string {
+    for _, set := range itemSets {
+        for _, piece := range set.Pieces {
+            if piece == id {
+                return set.Name
+            }
+        }
+    }
+    return ""
+}
+
+// Decrit les bonus d'un palier
+func (t SetTier) describe() string {
+    parts := []string{}
+    if t.MaxHP > 0 {
+        parts = append(parts, fmt.Sprintf("+%d HP max", t.MaxHP))
+    }
+    if t.MaxMana > 0 {
+        parts = append(parts, fmt.Sprintf("+%d MP max", t.MaxMana))
+    }
+    if t.Attack > 0 {
+        parts = append(parts, fmt.Sprintf("+%d attaque", t.Attack))
+    }
+    if t.NoteDiscount > 0 {
+        parts = append(parts, fmt.Sprintf("Note explosive -%d MP", t.NoteDiscount))
+    }
+    if t.StartShield > 0 {
+        parts = append(parts, fmt.Sprintf("bouclier %d en debut de combat", t.StartShield))
+    }
+    return strings.Join(parts, ", ")
+}
+
+// Nombre de pieces d'un ensemble portees par le personnage
+func (c *Character) setPieces(set ItemSet) int {
+    worn := 0
+    for _, id := range set.Pieces {
+        if piece, ok := c.Equipment[items[id].Slot]; ok && piece.ID == id {
+            worn++
+        }
+    }
+    return worn
+}
+
+// Cumul des paliers d'ensemble actifs
+func (c *Character) setBonus() SetTier {
+    var total SetTier
+    for _, set := range itemSets {
+        worn := c.setPieces(set)
+        for _, tier := range set.Tiers {
+            if worn < tier.Count {
+                continue
+            }
+            total.MaxHP += tier.MaxHP
+            total.MaxMana += tier.MaxMana
+            total.Attack += tier.Attack
+            total.NoteDiscount += tier.NoteDiscount
+            total.StartShield += tier.StartShield
+        }
+    }
+    return total
+}
+
+// Cout en mana de Note explosive apres bonus d'ensemble et competences
+func (c *Character) noteCost() int {
+    return max(10-c.setBonus().NoteDiscount-c.skillBonus().NoteDiscount, 0)
+}
+
+// Applique les bonus d'ensemble qui se declenchent en debut de combat
+func (c *Character) applySetOpeners() {
+    if shield := c.setBonus().StartShield; shield > 0 && c.HP > 0 {
+        c.ShieldHP += shield
+        fmt.Printf("%s entre en scene protege par sa tenue (bouclier %d).\n", c.Name, shield)
+    }
+}
+
+// Affiche la progression des ensembles dont au moins une piece est portee
+func (c *Character) printSets() {
+    header := false
+    for _, set := range itemSets {
+        worn := c.setPieces(set)
+        if worn == 0 {
+            continue
+        }
+        if !header {
+            fmt.Println("-- Ensembles --")
+            header = true
+        }
+        fmt.Printf("%s %d/%d\n", set.Name, worn, len(set.Pieces))
+        for _, tier := range set.Tiers {
+            mark := " "
+            if worn >= tier.Count {
+                mark = "x"
+            }
+            fmt.Printf("  [%s] %d pieces: %s\n", mark, tier.Count, tier.describe())
+        }
+    }
+}
+
+// Raretes d'equipement, de la plus courante a la plus rare
+const (
+    rarityCommon    = "commune"
+    rarityRare      = "rare"
+    rarityEpic      = "epique"
+    rarityLegendary = "legendaire"
+)
+
+// Reglages d'une rarete: poids de tirage, nombre d'affixes, couleur et valeur de revente
+type rarityTier struct {
+    ID      string
+    Weight  int
+    Affixes int
+    Color   string
+    Value   float64
+}
+
+var rarities = []rarityTier{
+    {ID: rarityCommon, Weight: 60, Affixes: 0, Color: "", Value: 1},
+    {ID: rarityRare, Weight: 25, Affixes: 1, Color: "\033[34m", Value: 1.5},
+    {ID: rarityEpic, Weight: 11, Affixes: 2, Color: "\033[35m", Value: 2},
+    {ID: rarityLegendary, Weight: 4, Affixes: 3, Color: "\033[33m", Value: 3},
+}
+
+const colorReset = "\033[0m"
+
+// Retrouve une rarete (commune si inconnue ou absente)
+func rarityOf(id string) rarityTier {
+    for _, r := range rarities {
+        if r.ID == id {
+            return r
+        }
+    }
+    return rarities[0]
+}
+
+// Affixes possibles sur une piece d'equipement
+const (
+    affixMaxHP       = "max_hp"
+    affixMaxMana     = "max_mana"
+    affixCrit        = "crit"
+    affixPoison      = "poison"
+    affixSpecialCost = "special_cost"
+)
+
+// Bonus aleatoire porte par un exemplaire d'equipement
+type Affix struct {
+    Kind  string
+    Value int
+}
+
+// Fourchette de valeur d'un affixe pour une piece commune; chaque rarete ajoute sa part
+var affixRanges = map[string][2]int{
+    affixMaxHP:       {5, 10},
+    affixMaxMana:     {3, 6},
+    affixCrit:        {4, 8},
+    affixPoison:      {2, 4},
+    affixSpecialCost: {1, 3},
+}
+
+var affixOrder = []string{affixMaxHP, affixMaxMana, affixCrit, affixPoison, affixSpecialCost}
+
+// Decrit un affixe pour les listes
+func (a Affix) describe() string {
+    switch a.Kind {
+    case affixMaxHP:
+        return fmt.Sprintf("+%d HP max", a.Value)
+    case affixMaxMana:
+        return fmt.Sprintf("+%d MP max", a.Value)
+    case affixCrit:
+        return fmt.Sprintf("+%d%% critique", a.Value)
+    case affixPoison:
+        return fmt.Sprintf("poison %d au toucher", a.Value)
+    case affixSpecialCost:
+        return fmt.Sprintf("capacites -%d MP", a.Value)
+    default:
+        return a.Kind
+    }
+}
+
+// Tire la rarete et les affixes d'un nouvel exemplaire (les autres objets restent tels quels)
+func (g *Game) rollInstance(id string, qty int) []ItemStack {
+    if items[id].Slot == "" {
+        return []ItemStack{{ID: id, Qty: qty}}
+    }
+    out := []ItemStack{}
+    for n := 0; n < qty; n++ {
+        total := 0
+        for _, r := range rarities {
+            total += r.Weight
+        }
+        pick := g.rng.Intn(total)
+        tier := rarities[0]
+        for _, r := range rarities {
+            if pick < r.Weight {
+                tier = r
+                break
+            }
+            pick -= r.Weight
+        }
+        st := ItemStack{ID: id, Qty: 1, Rarity: tier.ID}
+        kinds := append([]string{}, affixOrder...)
+        g.rng.Shuffle(len(kinds), func(i, j int) { kinds[i], kinds[j] = kinds[j], kinds[i] })
+        for _, kind := range kinds[:tier.Affixes] {
+            span := affixRanges[kind]
+            value := span[0] + g.rng.Intn(span[1]-span[0]+1) + tier.Affixes - 1
+            st.Affixes = append(st.Affixes, Affix{Kind: kind, Value: value})
+        }
+        out = append(out, st)
+    }
+    return out
+}
+
+// Cumul des affixes portes par le personnage
+func (c *Character) affixTotal(kind string) int {
+    total := 0
+    for _, piece := range c.Equipment {
+        for _, a := range piece.Affixes {
+            if a.Kind == kind {
+                total += a.Value
+            }
+        }
+    }
+    return total
+}
+
+// Double les degats d'une attaque selon la chance de critique de l'equipement
+func (g *Game) gearCrit(c *Character, dmg int) int {
+    if chance := c.affixTotal(affixCrit); chance > 0 && g.rng.Intn(100) < chance {
+        fmt.Println("Coup critique !")
+        return dmg * 2
+    }
+    return dmg
+}
+
+// Empoisonne la cible touchee si l'equipement le permet
+func (c *Character) gearOnHit(target *Enemy) {
+    if dmg := c.affixTotal(affixPoison); dmg > 0 && target.HP > 0 {
+        target.PoisonTurns = max(target.PoisonTurns, 2)
+        target.PoisonDmg = max(target.PoisonDmg, dmg)
+        fmt.Printf("%s est empoisonne par l'equipement de %s.\n", target.Name, c.Name)
+    }
+}
+
+// Cout en mana d'une capacite apres reductions d'equipement et de competences
+func (c *Character) specialCost(cost int) int {
+    return max(cost-c.affixTotal(affixSpecialCost)-c.skillBonus().SpecialDiscount, 0)
+}
+
+// Gains de stats par niveau d'une classe
+type classGrowth struct {
+    HP   int
+    Mana int
+}
+
+// Courbe d'experience, plafond de niveau et croissance par classe
+type progressionRules struct {
+    LevelCap   int
+    XPCurve    []int
+    BenchShare float64
+    Default    classGrowth
+    Classes    map[string]classGrowth
+}
+
+// Regles de progression (chargees depuis data/progression.json)
+var progression progressionRules
+
+// Liste les incoherences des regles de progression
+func checkProgression(p progressionRules) []string {
+    problems := []string{}
+    if p.LevelCap < 2 {
+        problems = append(problems, "LevelCap doit valoir au moins 2")
+    }
+    if len(p.XPCurve) < p.LevelCap-1 {
+        problems = append(problems, fmt.Sprintf("XPCurve doit donner %d paliers (un par niveau avant le plafond)", p.LevelCap-1))
+    }
+    for i, xp := range p.XPCurve {
+        if xp <= 0 {
+            problems = append(problems, fmt.Sprintf("XPCurve: palier %d non positif", i+1))
+        }
+    }
+    if p.BenchShare < 0 || p.BenchShare > 1 {
+        problems = append(problems, "BenchShare doit etre entre 0 et 1")
+    }
+    for name, growth := range p.Classes {
+        if growth.HP < 0 || growth.Mana < 0 {
+            problems = append(problems, fmt.Sprintf("classe %q: gains negatifs", name))
+        }
+    }
+    return problems
+}
+
+// Experience requise pour passer du niveau donne au suivant (0 au plafond)
+func xpToNext(level int) int {
+    if level >= progression.LevelCap || level-1 >= len(progression.XPCurve) {
+        return 0
+    }
+    return progression.XPCurve[level-1]
+}
+
+// Croissance de la classe du personnage
+func (c *Character) growth() classGrowth {
+    if g, ok := progression.Classes[c.Class]; ok {
+        return g
+    }
+    return progression.Default
+}
+
+// Donne une part de l'experience aux allies recrutes restes en reserve
+func (g *Game) shareBenchXP(fighters []*Character, xp int) {
+    share := int(float64(xp) * progression.BenchShare)
+    if share <= 0 {
+        return
+    }
+    for _, ch := range g.Characters {
+        if !ch.Unlocked || slices.Contains(fighters, ch) {
+            continue
+        }
+        fmt.Printf("%s (en reserve) gagne %d XP.\n", ch.Name, share)
+        ch.gainXP(share)
+    }
 }
 
 // Statistiques et etat d'un personnage jouable
@@ -79,14 +761,21 @@ type Character struct {
     HP           int
     MaxMana      int
     Mana         int
+    BaseMaxHP    int
+    BaseMaxMana  int
+    Equipment    Gear
     Level        int
     XP           int
     BetPts       int
-    Inventory    []string
+    Inventory    Inventory
     InventoryMax int
     Unlocked     bool
     HasNoteSpell bool
     SpecialUsed  bool
+    SkillPoints  int
+    Skills       map[string]bool
+    Affinity     int
+    Traits       map[string]int
 
     BattleBoost int
     IgnoreGuard bool
@@ -102,6 +791,7 @@ type Enemy struct {
     HP        int
     Attack    int
     CritTimer int
+    CritEvery int
     Style     string
 
     PoisonTurns int
@@ -121,6 +811,19 @@ type battleOptions struct {
     RewardGold   int
     RewardBetPts int
     IsBoss       bool
+    Region       string
+
+    Reinforcements []reinforcementWave
+    MaxOnField     int
+}
+
+// Renforts appeles par l'ennemi a un tour donne
+type reinforcementWave struct {
+    Round      int
+    Call       string
+    Enemies    []Enemy
+    RewardXP   int
+    RewardGold int
 }
 
 // Suit le deblocage et l'avancement d'une zone
@@ -140,9 +843,49 @@ func zoneLabel(z ZoneStatus) string {
     }
 }
 
+// Reglages d'un mode de difficulte
+type difficultySettings struct {
+    ID          string
+    Name        string
+    EnemyHP     float64
+    EnemyAttack float64
+    CritShift   int
+    Rewards     float64
+    Prices      float64
+    ReviveRatio float64
+}
+
+const (
+    difficultyEasy      = "facile"
+    difficultyNormal    = "normal"
+    difficultyHard      = "difficile"
+    difficultyNightmare = "cauchemar"
+)
+
+// Modes de difficulte du plus doux au plus dur (ReviveRatio 0 = releve a 1 HP, CritShift decale la cadence critique propre a chaque ennemi)
+var difficulties = []difficultySettings{
+    {ID: difficultyEasy, Name: "Facile", EnemyHP: 0.8, EnemyAttack: 0.8, CritShift: 1, Rewards: 0.8, Prices: 0.8, ReviveRatio: 1},
+    {ID: difficultyNormal, Name: "Normal", EnemyHP: 1, EnemyAttack: 1, CritShift: 0, Rewards: 1, Prices: 1, ReviveRatio: 0.5},
+    {ID: difficultyHard, Name: "Difficile", EnemyHP: 1.25, EnemyAttack: 1.2, CritShift: -1, Rewards: 1.25, Prices: 1.2, ReviveRatio: 0.25},
+    {ID: difficultyNightmare, Name: "Cauchemar", EnemyHP: 1.5, EnemyAttack: 1.4, CritShift: -2, Rewards: 1.5, Prices: 1.5, ReviveRatio: 0},
+}
+
+// Retrouve le rang d'une difficulte (Normal si inconnue)
+func difficultyRank(id string) int {
+    for i, d := range difficulties {
+        if d.ID == id {
+            return i
+        }
+    }
+    return 1
+}
+
 // Contenu serialise d'une sauvegarde
 type SaveState struct {
     ProfileName     string
+    Difficulty      string
+    Ironman         bool
+    Locked          bool
     PlayerIndex     int
     Characters      []Character
     StoryStage      int
@@ -154,6 +897,22 @@ type SaveState struct {
     Gold            int
     Flags           map[string]bool
     ZoneStatus      map[string]ZoneStatus
+    Bets            BetLedger
+    Stash           Inventory
+    StashSealed     bool
+    Shop            ShopState
+    KnownRecipes    map[string]bool
+    CraftXP         int
+    Crafted         map[string]int
+    Wins            int
+    Achievements    map[string]time.Time
+    PlayTime        time.Duration
+    QuestProgress   map[string]int
+    Cycle           int
+    Bestiary        map[string]BestiaryEntry
+    Endings         map[string]int
+    Fame            map[string]RegionFame
+    Battles         int
     Timestamp       time.Time
 }
 
@@ -282,19 +1041,188 @@ func (sm *SaveManager) list() ([]string, error) {
     return names, nil
 }
 
-// Etat global de la partie en cours
-type Game struct {
-    PlayerIndex     int
-    Characters      []*Character
-    StoryStage      int
-    TrainingLevel   int
-    TrainingBaseHP  int
-    TrainingBaseAtk int
-    FarmLevel       int
+// Trace d'une course ironman terminee
+type HallOfFameRecord struct {
+    Profile    string
+    Difficulty string
+    StoryStage int
+    MaxLevel   int
+    Allies     int
+    Gold       int
+    Cause      string
+    Victory    bool
+    Cycle      int
+    EndedAt    time.Time
+}
+
+// Chemin d'un fichier partage entre profils (hors liste des sauvegardes)
+func (sm *SaveManager) globalPath(file string) string {
+    return filepath.Join(sm.dir(), "global", file)
+}
+
+func (sm *SaveManager) loadHallOfFame() ([]HallOfFameRecord, error) {
+    file, err := os.Open(sm.globalPath("hall_of_fame.json"))
+    if err != nil {
+        if errors.Is(err, fs.ErrNotExist) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    defer file.Close()
+    var records []HallOfFameRecord
+    if err := json.NewDecoder(file).Decode(&records); err != nil {
+        return nil, err
+    }
+    return records, nil
+}
+
+func (sm *SaveManager) recordHallOfFame(rec HallOfFameRecord) error {
+    records, err := sm.loadHallOfFame()
+    if err != nil {
+        return err
+    }
+    records = append(records, rec)
+    if err := os.MkdirAll(filepath.Dir(sm.globalPath("hall_of_fame.json")), 0o755); err != nil {
+        return err
+    }
+    file, err := os.Create(sm.globalPath("hall_of_fame.json"))
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    enc := json.NewEncoder(file)
+    enc.SetIndent("", "  ")
+    return enc.Encode(records)
+}
+
+// Trace partagee d'un succes debloque sur au moins un profil
+type GlobalAchievement struct {
+    Profiles []string
+    FirstAt  time.Time
+}
+
+func (sm *SaveManager) loadGlobalAchievements() (map[string]GlobalAchievement, error) {
+    file, err := os.Open(sm.globalPath("achievements.json"))
+    if err != nil {
+        if errors.Is(err, fs.ErrNotExist) {
+            return map[string]GlobalAchievement{}, nil
+        }
+        return nil, err
+    }
+    defer file.Close()
+    records := map[string]GlobalAchievement{}
+    if err := json.NewDecoder(file).Decode(&records); err != nil {
+        return nil, err
+    }
+    return records, nil
+}
+
+func (sm *SaveManager) recordGlobalAchievement(id, profile string) error {
+    records, err := sm.loadGlobalAchievements()
+    if err != nil {
+        return err
+    }
+    rec := records[id]
+    if slices.Contains(rec.Profiles, profile) {
+        return nil
+    }
+    if len(rec.Profiles) == 0 {
+        rec.FirstAt = time.Now()
+    }
+    rec.Profiles = append(rec.Profiles, profile)
+    records[id] = rec
+    if err := os.MkdirAll(filepath.Dir(sm.globalPath("achievements.json")), 0o755); err != nil {
+        return err
+    }
+    file, err := os.Create(sm.globalPath("achievements.json"))
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    enc := json.NewEncoder(file)
+    enc.SetIndent("", "  ")
+    return enc.Encode(records)
+}
+
+// Nom lisible d'une etape du scenario
+func stageName(stage int) string {
+    switch stage {
+    case stagePrologue:
+        return "Prologue"
+    case stageArtists:
+        return "Recrutement des artistes"
+    case stageMacron:
+        return "Palais presidentiel"
+    case stageLabel:
+        return "QG du label"
+    default:
+        return "Histoire terminee"
+    }
+}
+
+// Affiche les courses ironman passees, les plus avancees en premier
+func showHallOfFame(sm *SaveManager) {
+    banner("Hall of fame ironman")
+    records, err := sm.loadHallOfFame()
+    if err != nil {
+        fmt.Println("Lecture impossible:", err)
+        return
+    }
+    if len(records) == 0 {
+        fmt.Println("Aucune course ironman terminee pour l'instant.")
+        return
+    }
+    sort.SliceStable(records, func(i, j int) bool {
+        if records[i].StoryStage != records[j].StoryStage {
+            return records[i].StoryStage > records[j].StoryStage
+        }
+        return records[i].MaxLevel > records[j].MaxLevel
+    })
+    for i, rec := range records {
+        result := "tombe: " + rec.Cause
+        if rec.Victory {
+            result = "cassette recuperee"
+        }
+        mode := rec.Difficulty
+        if rec.Cycle > 0 {
+            mode += fmt.Sprintf(" NG+%d", rec.Cycle)
+        }
+        fmt.Printf("%d) %s [%s] - %s | niv. %d | %d allies | %d or | %s (%s)\n", i+1, rec.Profile, mode, stageName(rec.StoryStage), rec.MaxLevel, rec.Allies, rec.Gold, result, rec.EndedAt.Format("02/01/2006"))
+    }
+}
+
+// Etat global de la partie en cours
+type Game struct {
+    Difficulty      string
+    Ironman         bool
+    Locked          bool
+    PlayerIndex     int
+    Characters      []*Character
+    StoryStage      int
+    TrainingLevel   int
+    TrainingBaseHP  int
+    TrainingBaseAtk int
+    FarmLevel       int
     CraftUnlocked   bool
     Gold            int
     Flags           map[string]bool
     ZoneStatus      map[string]ZoneStatus
+    Bets            BetLedger
+    Stash           Inventory
+    StashSealed     bool
+    Shop            ShopState
+    KnownRecipes    map[string]bool
+    CraftXP         int
+    Crafted         map[string]int
+    Wins            int
+    Achievements    map[string]time.Time
+    PlayTime        time.Duration
+    QuestProgress   map[string]int
+    Cycle           int
+    Bestiary        map[string]BestiaryEntry
+    Endings         map[string]int
+    Fame            map[string]RegionFame
+    Battles         int
     rng             *rand.Rand
     saver           *SaveManager
     profile         string
@@ -305,6 +1233,12 @@ type Game struct {
     recipes       []RecipeDefinition
 
     menuReturnRequested bool
+    lastAllyKO          bool
+    sessionStart        time.Time
+    itemsUsed           int
+    rewardWaiting       map[string]bool
+    observed            map[string]bool
+    region              string
 }
 
 var activeGame *Game
@@ -321,94 +1255,62 @@ func (g *Game) consumeMenuReturn() bool {
     return true
 }
 
+// Dossier des fichiers de contenu (objets, recettes, butin, ensembles, progression, quetes)
+const contentDirName = "data"
+
+// Copie des fichiers de contenu embarquee dans l'executable
+//
+//go:embed data/items.json data/recipes.json data/loot.json data/sets.json data/progression.json data/quests.json
+var builtinContent embed.FS
+
+// Primitives d'effet composables depuis les fichiers de contenu
 const (
-    effHeal        = "heal"
-    effMana        = "mana"
-    effPoison      = "poison"
-    effNote        = "note"
-    effBag         = "bag"
-    effHat         = "hat"
-    effBoot        = "boot"
-    effTunic       = "tunic"
-    effGlove       = "glove"
-    effDiscHater   = "disc_hater"
-    effDiscCrew    = "disc_crew"
-    effDiscBoss    = "disc_boss"
-    effDiscPoison  = "disc_poison"
-    effBoostX2     = "boost_x2"
-    effBoostX4     = "boost_x4"
-    effPass        = "pass"
-    effCrew        = "crew"
+    effHeal       = "heal"
+    effMana       = "mana"
+    effDamage     = "damage"
+    effStatus     = "status"
+    effMaxHP      = "max_hp"
+    effLearn      = "learn"
+    effSelfDamage = "self_damage"
+    effBag        = "bag"
+    effRevive     = "revive"
 )
 
-// Catalogue des objets achetables ou trouvables
-var items = map[string]ItemDefinition{
-    "potion_hp":     {ID: "potion_hp", Name: "Potion de vie", Description: "Rend 50 HP", Type: itemConsumable, Price: 3, EffectID: effHeal},
-    "potion_mana":   {ID: "potion_mana", Name: "Potion d'energie", Description: "Rend 20 MP", Type: itemConsumable, Price: 5, EffectID: effMana},
-    "potion_poison": {ID: "potion_poison", Name: "Potion contaminee", Description: "Necessaire pour fabriquer des disques toxiques", Type: itemConsumable, Price: 6, EffectID: effPoison},
-    "grimoire_note": {ID: "grimoire_note", Name: "Livre Note explosive", Description: "Apprend la note explosive", Type: itemSpecial, Price: 25, EffectID: effNote},
-    "bag_upgrade":   {ID: "bag_upgrade", Name: "Extension sacoche", Description: "Ajoute 10 emplacements (max 3)", Type: itemSpecial, Price: 30, EffectID: effBag},
-    "mat_loup":      {ID: "mat_loup", Name: "Sample de Loup", Description: "Sample brut", Type: itemMaterial, Price: 4},
-    "mat_troll":     {ID: "mat_troll", Name: "Partition de Troll", Description: "Partition dechiree", Type: itemMaterial, Price: 7},
-    "mat_sanglier":  {ID: "mat_sanglier", Name: "Cable de Sanglier", Description: "Cable sauvage", Type: itemMaterial, Price: 3},
-    "mat_corb":      {ID: "mat_corb", Name: "Plume de Corbeau", Description: "Plume sombre", Type: itemMaterial, Price: 1},
-    "equip_hat":     {ID: "equip_hat", Name: "Chapeau de scene", Description: "+10 HP max", Type: itemEquipment, EffectID: effHat},
-    "equip_boot":    {ID: "equip_boot", Name: "Bottes de scene", Description: "+15 HP max", Type: itemEquipment, EffectID: effBoot},
-    "equip_tunic":   {ID: "equip_tunic", Name: "Tunique de scene", Description: "+25 HP max", Type: itemEquipment, EffectID: effTunic},
-    "equip_glove":   {ID: "equip_glove", Name: "Gant legendaire", Description: "+25 HP max", Type: itemEquipment, EffectID: effGlove},
-    "disc_loup":     {ID: "disc_loup", Name: "Disque Loup", Description: "Bonus contre les haters", Type: itemSpecial, EffectID: effDiscHater},
-    "disc_troll":    {ID: "disc_troll", Name: "Disque Troll", Description: "Bonus contre les crews solides", Type: itemSpecial, EffectID: effDiscCrew},
-    "disc_sanglier": {ID: "disc_sanglier", Name: "Disque Sanglier", Description: "Ignore la garde des boss", Type: itemSpecial, EffectID: effDiscBoss},
-    "disc_corb":     {ID: "disc_corb", Name: "Disque Corbeau", Description: "Empoisonne pendant deux tours", Type: itemSpecial, EffectID: effDiscPoison},
-    "boost_x2":      {ID: "boost_x2", Name: "Boost degats x2", Description: "Double les degats pour ce combat", Type: itemBoost, BetPointCost: 15, EffectID: effBoostX2},
-    "boost_x4":      {ID: "boost_x4", Name: "Boost degats x4", Description: "Degats x4 pour ce combat", Type: itemBoost, BetPointCost: 40, EffectID: effBoostX4},
-    "pass_label":    {ID: "pass_label", Name: "Pass presidentiel", Description: "Ouvre l'acces au QG du label", Type: itemSpecial, EffectID: effPass},
-    "crew_totem":    {ID: "crew_totem", Name: "Pouvoir d'invocation", Description: "Invoque le crew de Kaaris", Type: itemSpecial, EffectID: effCrew},
-}
-
-// Recettes disponibles chez le forgeron
-var recipes = []RecipeDefinition{
-    {ID: "rec_hat", Name: "Chapeau de scene", Inputs: []string{"mat_corb", "mat_sanglier"}, OutputID: "equip_hat", CraftCost: 5},
-    {ID: "rec_boot", Name: "Bottes de scene", Inputs: []string{"mat_loup", "mat_sanglier"}, OutputID: "equip_boot", CraftCost: 5},
-    {ID: "rec_tunic", Name: "Tunique de scene", Inputs: []string{"mat_loup", "mat_loup", "mat_troll"}, OutputID: "equip_tunic", CraftCost: 8},
-    {ID: "rec_disc_l", Name: "Disque Loup", Inputs: []string{"mat_loup", "potion_poison"}, OutputID: "disc_loup", CraftCost: 0},
-    {ID: "rec_disc_t", Name: "Disque Troll", Inputs: []string{"mat_troll", "potion_poison"}, OutputID: "disc_troll", CraftCost: 0},
-    {ID: "rec_disc_s", Name: "Disque Sanglier", Inputs: []string{"mat_sanglier", "potion_poison"}, OutputID: "disc_sanglier", CraftCost: 0},
-    {ID: "rec_disc_c", Name: "Disque Corbeau", Inputs: []string{"mat_corb", "potion_poison"}, OutputID: "disc_corb", CraftCost: 0},
-}
-
-// Implementation des effets declenches par chaque objet
-var effects = map[string]func(g *Game, c *Character, enemy *Enemy) bool{
-    effHeal: func(g *Game, c *Character, enemy *Enemy) bool {
-        heal := 50
-        if c.HP+heal > c.MaxHP {
-            c.HP = c.MaxHP
-        } else {
-            c.HP += heal
-        }
-        fmt.Printf("%s boit une potion de vie (+50 HP).\n", c.Name)
-        return true
-    },
-    effMana: func(g *Game, c *Character, enemy *Enemy) bool {
-        gain := 20
-        if c.Mana+gain > c.MaxMana {
-            c.Mana = c.MaxMana
-        } else {
-            c.Mana += gain
-        }
-        fmt.Printf("%s retrouve 20 MP.\n", c.Name)
-        return true
-    },
-    effPoison: func(g *Game, c *Character, enemy *Enemy) bool {
-        loss := 30
-        c.HP -= loss
-        if c.HP < 0 {
-            c.HP = 0
-        }
-        fmt.Println("Cette potion est trop toxique pour etre bu. Gardez-la pour le craft.")
-        return true
-    },
-    effNote: func(g *Game, c *Character, enemy *Enemy) bool {
+// Etats applicables par la primitive "status"
+const (
+    statusPoison     = "poison"
+    statusWeaken     = "weaken"
+    statusSilence    = "silence"
+    statusGuardBreak = "guard_break"
+    statusBoost      = "boost"
+)
+
+// Etape d'effet d'un objet; les champs utiles dependent de Kind
+type EffectStep struct {
+    Kind      string
+    Amount    int
+    Bonus     int
+    BonusType EnemyType
+    Status    string
+    Turns     int
+    Spell     string
+    Ratio     float64
+    Max       int
+    Text      string
+}
+
+// Cibles d'objet accessibles depuis les fichiers de contenu (soi-meme par defaut)
+var itemTargets = map[string]targetKind{
+    "":        targetSelf,
+    "self":    targetSelf,
+    "ally":    targetAlly,
+    "ko_ally": targetKOAlly,
+    "enemy":   targetEnemy,
+}
+
+// Sorts qu'un objet peut apprendre
+var learnableSpells = map[string]func(c *Character) bool{
+    "note": func(c *Character) bool {
         if c.HasNoteSpell {
             fmt.Println("Vous connaissez deja Note explosive.")
             return false
@@ -417,114 +1319,429 @@ var effects = map[string]func(g *Game, c *Character, enemy *Enemy) bool{
         fmt.Println("Note explosive apprise !")
         return true
     },
-    effBag: func(g *Game, c *Character, enemy *Enemy) bool {
-        if c.InventoryMax >= 40 {
-            fmt.Println("Votre sacoche est deja optimisee.")
-            return false
+}
+
+// Catalogue des objets achetables ou trouvables (charge depuis data/items.json)
+var items = map[string]ItemDefinition{}
+
+// Identifiants des objets dans l'ordre des fichiers de contenu
+var itemOrder []string
+
+// Recettes disponibles chez le forgeron (chargees depuis data/recipes.json)
+var recipes []RecipeDefinition
+
+// Objets cites directement par le code (histoire, depart, disques, cadeaux): ils doivent exister dans items.json
+func requiredItems() []string {
+    ids := []string{"potion_hp", "equip_glove", "crew_totem", "pass_label"}
+    ids = append(ids, discItems...)
+    names := make([]string, 0, len(giftLikes))
+    for name := range giftLikes {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        ids = append(ids, giftLikes[name]...)
+    }
+    return ids
+}
+
+// Verifie que chaque cle JSON reprend exactement le nom d'un champ (encoding/json tolere les ecarts de casse)
+func checkKeys(v any, t reflect.Type, path string) []string {
+    for t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+    if reflect.PointerTo(t).Implements(reflect.TypeFor[json.Unmarshaler]()) {
+        return nil
+    }
+    var problems []string
+    switch val := v.(type) {
+    case []any:
+        if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+            return nil
         }
-        c.InventoryMax += 10
-        fmt.Printf("Capacite de sacoche portee a %d objets.\n", c.InventoryMax)
-        return true
-    },
-    effHat: func(g *Game, c *Character, enemy *Enemy) bool {
-        c.MaxHP += 10
-        c.HP += 10
-        fmt.Println("Vous portez le Chapeau de scene : +10 HP max.")
-        return true
-    },
-    effBoot: func(g *Game, c *Character, enemy *Enemy) bool {
-        c.MaxHP += 15
-        c.HP += 15
-        fmt.Println("Bottes de scene equipees : +15 HP max.")
-        return true
-    },
-    effTunic: func(g *Game, c *Character, enemy *Enemy) bool {
-        c.MaxHP += 25
-        c.HP += 25
-        fmt.Println("Tunique de scene equipee : +25 HP max.")
-        return true
-    },
-    effGlove: func(g *Game, c *Character, enemy *Enemy) bool {
-        c.MaxHP += 25
-        c.HP += 25
-        fmt.Println("Le Gant legendaire pulse. +25 HP max.")
-        return true
-    },
-    effDiscHater: func(g *Game, c *Character, enemy *Enemy) bool {
-        if enemy == nil {
-            fmt.Println("Ce disque doit etre utilise en combat.")
-            return false
+        for i, item := range val {
+            label := fmt.Sprintf("%s[%d]", path, i)
+            if obj, ok := item.(map[string]any); ok {
+                if id, ok := obj["ID"].(string); ok && id != "" {
+                    label = fmt.Sprintf("%s[%s]", path, id)
+                }
+            }
+            problems = append(problems, checkKeys(item, t.Elem(), label)...)
         }
-        dmg := 10
-        if enemy.Type == enemyHater {
-            dmg += 10
+    case map[string]any:
+        keys := make([]string, 0, len(val))
+        for k := range val {
+            keys = append(keys, k)
         }
-        enemy.HP -= dmg
-        if enemy.HP < 0 {
-            enemy.HP = 0
+        sort.Strings(keys)
+        for _, k := range keys {
+            switch t.Kind() {
+            case reflect.Map:
+                problems = append(problems, checkKeys(val[k], t.Elem(), path+"."+k)...)
+            case reflect.Struct:
+                f, ok := t.FieldByName(k)
+                if !ok || !f.IsExported() {
+                    problems = append(problems, fmt.Sprintf("%s: champ inconnu %q", strings.TrimPrefix(path, "."), k))
+                    continue
+                }
+                problems = append(problems, checkKeys(val[k], f.Type, path+"."+k)...)
+            }
         }
-        fmt.Printf("Disque de Loup : %s subit %d degats.\n", enemy.Name, dmg)
-        return true
-    },
-    effDiscCrew: func(g *Game, c *Character, enemy *Enemy) bool {
-        if enemy == nil {
-            fmt.Println("Ce disque doit etre utilise en combat.")
-            return false
+    }
+    return problems
+}
+
+// Lit un fichier de contenu, en preferant la copie du dossier data a la version embarquee
+func readContent(dir, name string) ([]byte, error) {
+    data, err := os.ReadFile(filepath.Join(dir, name))
+    if err == nil {
+        return data, nil
+    }
+    if !errors.Is(err, fs.ErrNotExist) {
+        return nil, err
+    }
+    return builtinContent.ReadFile(contentDirName + "/" + name)
+}
+
+// Charge et valide le catalogue; toutes les erreurs trouvees sont renvoyees ensemble
+func loadContent(dir string) error {
+    var defs []ItemDefinition
+    var recs []RecipeDefinition
+    var loot []LootTable
+    var sets []ItemSet
+    var rules progressionRules
+    var quas []QuestDefinition
+    files := []struct {
+        name string
+        dst  any
+    }{
+        {"items.json", &defs},
+        {"recipes.json", &recs},
+        {"loot.json", &loot},
+        {"sets.json", &sets},
+        {"progression.json", &rules},
+        {"quests.json", &quas},
+    }
+    var errs []error
+    for _, f := range files {
+        data, err := readContent(dir, f.name)
+        if err != nil {
+            return fmt.Errorf("%s: %w", f.name, err)
         }
-        dmg := 15
-        if enemy.Type == enemyCrew {
-            dmg += 15
+        dec := json.NewDecoder(bytes.NewReader(data))
+        dec.DisallowUnknownFields()
+        if err := dec.Decode(f.dst); err != nil {
+            return fmt.Errorf("%s: %w", f.name, err)
         }
-        enemy.HP -= dmg
-        if enemy.HP < 0 {
-            enemy.HP = 0
+        var raw any
+        if err := json.Unmarshal(data, &raw); err != nil {
+            return fmt.Errorf("%s: %w", f.name, err)
         }
-        fmt.Printf("Disque de Troll : %s subit %d degats.\n", enemy.Name, dmg)
-        return true
-    },
-    effDiscBoss: func(g *Game, c *Character, enemy *Enemy) bool {
-        c.IgnoreGuard = true
-        fmt.Println("Disque de Sanglier : votre prochaine attaque ignore la garde !")
+        for _, problem := range checkKeys(raw, reflect.TypeOf(f.dst), "") {
+            errs = append(errs, fmt.Errorf("%s: %s", f.name, problem))
+        }
+    }
+    catalog := map[string]ItemDefinition{}
+    order := []string{}
+    for i, def := range defs {
+        if def.ID == "" {
+            errs = append(errs, fmt.Errorf("items.json: objet n%d sans ID", i+1))
+            continue
+        }
+        if _, dup := catalog[def.ID]; dup {
+            errs = append(errs, fmt.Errorf("items.json: ID %q en double", def.ID))
+            continue
+        }
+        for _, problem := range checkItem(def) {
+            errs = append(errs, fmt.Errorf("items.json: objet %q: %s", def.ID, problem))
+        }
+        catalog[def.ID] = def
+        order = append(order, def.ID)
+    }
+    for _, id := range requiredItems() {
+        if _, ok := catalog[id]; !ok {
+            errs = append(errs, fmt.Errorf("items.json: objet %q introuvable alors que le jeu l'utilise", id))
+        }
+    }
+    seen := map[string]bool{}
+    combos := map[string]string{}
+    for i, rec := range recs {
+        label := fmt.Sprintf("recette %q", rec.ID)
+        if rec.ID == "" {
+            label = fmt.Sprintf("recette n%d", i+1)
+            errs = append(errs, fmt.Errorf("recipes.json: %s sans ID", label))
+        } else if seen[rec.ID] {
+            errs = append(errs, fmt.Errorf("recipes.json: ID %q en double", rec.ID))
+        }
+        seen[rec.ID] = true
+        if len(rec.Inputs) == 0 {
+            errs = append(errs, fmt.Errorf("recipes.json: %s: aucun ingredient", label))
+        }
+        for _, id := range rec.Inputs {
+            if _, ok := catalog[id]; !ok {
+                errs = append(errs, fmt.Errorf("recipes.json: %s: ingredient inconnu %q", label, id))
+            }
+        }
+        if _, ok := catalog[rec.OutputID]; !ok {
+            errs = append(errs, fmt.Errorf("recipes.json: %s: objet produit inconnu %q", label, rec.OutputID))
+        }
+        if rec.CraftCost < 0 {
+            errs = append(errs, fmt.Errorf("recipes.json: %s: cout negatif", label))
+        }
+        if rec.Skill < 0 || rec.Skill > craftMaxLevel {
+            errs = append(errs, fmt.Errorf("recipes.json: %s: Skill hors limites (0-%d)", label, craftMaxLevel))
+        }
+        if rec.Hidden && (len(rec.Inputs) < 2 || len(rec.Inputs) > 3) {
+            errs = append(errs, fmt.Errorf("recipes.json: %s: une recette secrete se decouvre avec 2 ou 3 ingredients", label))
+        }
+        if other, dup := combos[comboKey(rec.Inputs)]; dup {
+            errs = append(errs, fmt.Errorf("recipes.json: %s: memes ingredients que %q", label, other))
+        }
+        combos[comboKey(rec.Inputs)] = rec.ID
+    }
+    for _, id := range order {
+        if with := catalog[id].UpgradeWith; with != "" && catalog[with].Type != itemMaterial {
+            errs = append(errs, fmt.Errorf("items.json: objet %q: UpgradeWith %q n'est pas un materiau connu", id, with))
+        }
+    }
+    for i, t := range loot {
+        label := t.ID
+        if label == "" {
+            label = fmt.Sprintf("n%d", i+1)
+        }
+        for _, problem := range checkLootTable(t, catalog) {
+            errs = append(errs, fmt.Errorf("loot.json: table %q: %s", label, problem))
+        }
+    }
+    owner := map[string]string{}
+    for i, set := range sets {
+        label := set.ID
+        if label == "" {
+            label = fmt.Sprintf("n%d", i+1)
+        }
+        for _, problem := range checkItemSet(set, catalog) {
+            errs = append(errs, fmt.Errorf("sets.json: ensemble %q: %s", label, problem))
+        }
+        for _, id := range set.Pieces {
+            if other, taken := owner[id]; taken {
+                errs = append(errs, fmt.Errorf("sets.json: ensemble %q: %q appartient deja a %q", label, id, other))
+            }
+            owner[id] = label
+        }
+    }
+    for _, problem := range checkProgression(rules) {
+        errs = append(errs, fmt.Errorf("progression.json: %s", problem))
+    }
+    questIDs := map[string]bool{}
+    for _, q := range quas {
+        questIDs[q.ID] = true
+    }
+    seenQuests := map[string]bool{}
+    for i, q := range quas {
+        label := q.ID
+        if label == "" {
+            label = fmt.Sprintf("n%d", i+1)
+            errs = append(errs, fmt.Errorf("quests.json: quete %s sans ID", label))
+        } else if seenQuests[q.ID] {
+            errs = append(errs, fmt.Errorf("quests.json: ID %q en double", q.ID))
+        }
+        seenQuests[q.ID] = true
+        for _, problem := range checkQuest(q, catalog, questIDs) {
+            errs = append(errs, fmt.Errorf("quests.json: quete %q: %s", label, problem))
+        }
+    }
+    if len(errs) > 0 {
+        return errors.Join(errs...)
+    }
+    items = catalog
+    itemOrder = order
+    recipes = recs
+    lootTables = loot
+    itemSets = sets
+    progression = rules
+    quests = quas
+    return nil
+}
+
+// Liste les incoherences d'une definition d'objet
+func checkItem(def ItemDefinition) []string {
+    problems := []string{}
+    if def.Name == "" {
+        problems = append(problems, "nom manquant")
+    }
+    if _, ok := itemTypeNames[def.Type]; !ok {
+        problems = append(problems, fmt.Sprintf("type inconnu %q", def.Type))
+    }
+    if _, ok := slotNames[def.Slot]; def.Slot != "" && !ok {
+        problems = append(problems, fmt.Sprintf("emplacement inconnu %q", def.Slot))
+    }
+    if _, ok := itemTargets[def.Target]; !ok {
+        problems = append(problems, fmt.Sprintf("cible inconnue %q", def.Target))
+    }
+    if def.Price < 0 || def.BetPointCost < 0 || def.StackMax < 0 || def.Stock < 0 {
+        problems = append(problems, "prix, pile ou stock negatif")
+    }
+    if def.UpgradeWith != "" && def.Slot == "" && !hasScalableEffect(def) {
+        problems = append(problems, "UpgradeWith sur un objet sans bonus ni effet a renforcer")
+    }
+    if def.FameTier < 0 || def.FameTier >= len(fameTiers) {
+        problems = append(problems, fmt.Sprintf("FameTier hors limites (%d)", def.FameTier))
+    }
+    switch def.Zone {
+    case "", zoneMichael, zoneKaaris, zoneMacron:
+    default:
+        problems = append(problems, fmt.Sprintf("zone inconnue %q", def.Zone))
+    }
+    for i, step := range def.Effects {
+        prefix := fmt.Sprintf("effet %d (%s): ", i+1, step.Kind)
+        switch step.Kind {
+        case effHeal, effMana, effMaxHP, effSelfDamage:
+            if step.Amount <= 0 {
+                problems = append(problems, prefix+"Amount doit etre positif")
+            }
+        case effDamage:
+            if step.Amount <= 0 {
+                problems = append(problems, prefix+"Amount doit etre positif")
+            }
+            if step.Bonus > 0 && !knownEnemyType(step.BonusType) {
+                problems = append(problems, prefix+fmt.Sprintf("BonusType inconnu %q", step.BonusType))
+            }
+            if def.Target != "enemy" {
+                problems = append(problems, prefix+"demande la cible \"enemy\"")
+            }
+        case effStatus:
+            switch step.Status {
+            case statusPoison, statusWeaken, statusSilence:
+                if def.Target != "enemy" {
+                    problems = append(problems, prefix+"demande la cible \"enemy\"")
+                }
+                if step.Turns <= 0 {
+                    problems = append(problems, prefix+"Turns doit etre positif")
+                }
+            case statusBoost:
+                if step.Amount < 2 {
+                    problems = append(problems, prefix+"un boost multiplie par 2 au moins")
+                }
+            case statusGuardBreak:
+            default:
+                problems = append(problems, prefix+fmt.Sprintf("etat inconnu %q", step.Status))
+            }
+        case effLearn:
+            if _, ok := learnableSpells[step.Spell]; !ok {
+                problems = append(problems, prefix+fmt.Sprintf("sort inconnu %q", step.Spell))
+            }
+        case effBag:
+            if step.Amount <= 0 || step.Max <= 0 {
+                problems = append(problems, prefix+"Amount et Max doivent etre positifs")
+            }
+        case effRevive:
+            if step.Ratio <= 0 || step.Ratio > 1 {
+                problems = append(problems, prefix+"Ratio doit etre entre 0 et 1")
+            }
+            if def.Target != "ko_ally" {
+                problems = append(problems, prefix+"demande la cible \"ko_ally\"")
+            }
+        default:
+            problems = append(problems, prefix+"primitive inconnue")
+        }
+    }
+    return problems
+}
+
+func knownEnemyType(t EnemyType) bool {
+    switch t {
+    case enemyHater, enemyCrew, enemyRival, enemyBoss, enemyFarm:
         return true
-    },
-    effDiscPoison: func(g *Game, c *Character, enemy *Enemy) bool {
-        if enemy == nil {
-            fmt.Println("Ce disque doit etre utilise en combat.")
+    }
+    return false
+}
+
+// Execute une etape d'effet; renvoie vrai si elle a eu un effet
+func runEffect(c *Character, enemy *Enemy, def ItemDefinition, step EffectStep) bool {
+    if step.Text != "" {
+        fmt.Println(step.Text)
+    }
+    switch step.Kind {
+    case effHeal:
+        c.HP = min(c.HP+step.Amount, c.MaxHP)
+        fmt.Printf("%s utilise %s (+%d HP).\n", c.Name, def.Name, step.Amount)
+    case effMana:
+        c.Mana = min(c.Mana+step.Amount, c.MaxMana)
+        fmt.Printf("%s retrouve %d MP.\n", c.Name, step.Amount)
+    case effSelfDamage:
+        c.HP = max(c.HP-step.Amount, 0)
+        fmt.Printf("%s perd %d HP.\n", c.Name, step.Amount)
+    case effMaxHP:
+        c.BaseMaxHP += step.Amount
+        c.refreshStats()
+        c.HP = min(c.HP+step.Amount, c.MaxHP)
+        fmt.Printf("%s gagne %d HP max.\n", c.Name, step.Amount)
+    case effLearn:
+        return learnableSpells[step.Spell](c)
+    case effBag:
+        if c.InventoryMax >= step.Max {
+            fmt.Println("Votre sacoche est deja optimisee.")
             return false
         }
-        enemy.PoisonTurns = 2
-        enemy.PoisonDmg = 5
-        fmt.Printf("Disque de Corbeau : %s est empoisonne.\n", enemy.Name)
-        return true
-    },
-    effBoostX2: func(g *Game, c *Character, enemy *Enemy) bool {
-        c.BattleBoost = 2
-        fmt.Printf("%s entre en mode boost : degats x2.\n", c.Name)
-        return true
-    },
-    effBoostX4: func(g *Game, c *Character, enemy *Enemy) bool {
-        c.BattleBoost = 4
-        fmt.Printf("%s declenche la transe : degats x4 !\n", c.Name)
-        return true
-    },
-    effPass: func(g *Game, c *Character, enemy *Enemy) bool {
-        fmt.Println("Le pass presidentiel ouvrira certaines portes scenario.")
-        return false
-    },
-    effCrew: func(g *Game, c *Character, enemy *Enemy) bool {
+        c.InventoryMax = min(c.InventoryMax+step.Amount, step.Max)
+        fmt.Printf("Capacite de sacoche portee a %d objets.\n", c.InventoryMax)
+    case effRevive:
+        if c.HP > 0 {
+            fmt.Printf("%s est encore debout.\n", c.Name)
+            return false
+        }
+        c.HP = max(int(float64(c.MaxHP)*step.Ratio), 1)
+        fmt.Printf("Le public scande son nom : %s se releve (%d HP).\n", c.Name, c.HP)
+    case effDamage:
         if enemy == nil {
-            fmt.Println("Personne a viser.")
+            fmt.Println("Cet objet doit etre utilise en combat.")
             return false
         }
-        dmg := 25
-        enemy.HP -= dmg
-        if enemy.HP < 0 {
-            enemy.HP = 0
+        dmg := step.Amount
+        if step.Bonus > 0 && enemy.Type == step.BonusType {
+            dmg += step.Bonus
         }
-        fmt.Printf("Le crew de Kaaris surgit et inflige %d degats a %s !\n", dmg, enemy.Name)
+        hitEnemy(enemy, dmg)
+        fmt.Printf("%s : %s subit %d degats.\n", def.Name, enemy.Name, dmg)
+    case effStatus:
+        return applyStatus(c, enemy, def, step)
+    default:
+        return false
+    }
+    return true
+}
+
+// Pose un etat sur l'ennemi vise ou sur l'utilisateur
+func applyStatus(c *Character, enemy *Enemy, def ItemDefinition, step EffectStep) bool {
+    switch step.Status {
+    case statusGuardBreak:
+        c.IgnoreGuard = true
+        fmt.Printf("%s : votre prochaine attaque ignore la garde !\n", def.Name)
         return true
-    },
+    case statusBoost:
+        c.BattleBoost = step.Amount
+        fmt.Printf("%s entre en mode boost : degats x%d.\n", c.Name, step.Amount)
+        return true
+    }
+    if enemy == nil {
+        fmt.Println("Cet objet doit etre utilise en combat.")
+        return false
+    }
+    switch step.Status {
+    case statusPoison:
+        enemy.PoisonTurns = step.Turns
+        enemy.PoisonDmg = step.Amount
+        fmt.Printf("%s : %s est empoisonne.\n", def.Name, enemy.Name)
+    case statusWeaken:
+        enemy.WeakenTurns = max(enemy.WeakenTurns, step.Turns)
+        fmt.Printf("%s : %s est affaibli.\n", def.Name, enemy.Name)
+    case statusSilence:
+        enemy.SilenceTurns = max(enemy.SilenceTurns, step.Turns)
+        fmt.Printf("%s : %s est reduit au silence.\n", def.Name, enemy.Name)
+    }
+    return true
 }
+
 func read(reader *bufio.Reader) string {
     line, err := reader.ReadString('\n')
     trimmed := strings.TrimSpace(line)
@@ -623,28 +1840,41 @@ func showPartyHud(party []*Character, enemies []Enemy) {
 
 
 // Applique un objet sur un personnage et une cible eventuelle
-func applyItem(g *Game, c *Character, enemy *Enemy, id string) bool {
-    def, ok := items[id]
+func applyItem(g *Game, c *Character, enemy *Enemy, st ItemStack) bool {
+    def, ok := items[st.ID]
     if !ok {
         fmt.Println("Objet inconnu.")
         return false
     }
-    handler := effects[def.EffectID]
-    if handler == nil {
+    if def.Slot != "" {
+        fmt.Println("Cet equipement se porte: passez par Statistiques > Equiper.")
+        return false
+    }
+    if len(def.Effects) == 0 {
         fmt.Println("L'objet ne peut pas etre utilise ici.")
         return false
     }
-    consumed := handler(g, c, enemy)
+    consumed := false
+    for _, step := range def.Effects {
+        if runEffect(c, enemy, def, upgradeStep(step, st.Upgrade)) {
+            consumed = true
+        }
+    }
     return consumed
 }
 
 // Tente d'ajouter un objet a l'inventaire
 func (c *Character) addItem(id string) bool {
-    if len(c.Inventory) >= c.InventoryMax {
+    return c.addItems(id, 1)
+}
+
+// Tente d'ajouter plusieurs exemplaires d'un objet
+func (c *Character) addItems(id string, qty int) bool {
+    if !c.Inventory.canAdd(id, qty, c.InventoryMax) {
         fmt.Println("Votre sacoche est pleine.")
         return false
     }
-    c.Inventory = append(c.Inventory, id)
+    c.Inventory.add(id, qty)
     return true
 }
 
@@ -654,49 +1884,148 @@ func (c *Character) removeItems(ids []string) bool {
     for _, id := range ids {
         needed[id]++
     }
-    indexes := []int{}
-    for i, have := range c.Inventory {
-        if needed[have] > 0 {
-            needed[have]--
-            indexes = append(indexes, i)
+    for id, qty := range needed {
+        if c.Inventory.count(id) < qty {
+            return false
         }
     }
-    for _, rest := range needed {
-        if rest > 0 {
-            return false
-        }
+    for id, qty := range needed {
+        c.Inventory.remove(id, qty)
+    }
+    return true
+}
+
+// Complete les champs absents des anciennes sauvegardes
+func (c *Character) normalize() {
+    if c.BaseMaxHP <= 0 {
+        c.BaseMaxHP = c.MaxHP
+    }
+    if c.BaseMaxMana <= 0 {
+        c.BaseMaxMana = c.MaxMana
+    }
+    if c.Equipment == nil {
+        c.Equipment = Gear{}
+    }
+    // Les anciennes sauvegardes recuperent un point par niveau deja gagne
+    if c.Skills == nil {
+        c.Skills = map[string]bool{}
+        c.SkillPoints += c.Level - 1
+    }
+    if c.Traits == nil {
+        c.Traits = map[string]int{}
+    }
+    c.refreshStats()
+}
+
+// Recalcule HP et mana max a partir des stats de base et de l'equipement porte
+func (c *Character) refreshStats() {
+    bonus, skills := c.setBonus(), c.skillBonus()
+    hp := c.BaseMaxHP + bonus.MaxHP + skills.MaxHP + c.affixTotal(affixMaxHP)
+    mana := c.BaseMaxMana + bonus.MaxMana + skills.MaxMana + c.affixTotal(affixMaxMana)
+    for _, st := range c.Equipment {
+        def := items[st.ID]
+        hp += upgraded(def.MaxHPBonus, st.Upgrade)
+        mana += upgraded(def.MaxManaBonus, st.Upgrade)
+    }
+    c.MaxHP, c.MaxMana = hp, mana
+    if c.HP > c.MaxHP {
+        c.HP = c.MaxHP
+    }
+    if c.Mana > c.MaxMana {
+        c.Mana = c.MaxMana
     }
-    for i := len(indexes) - 1; i >= 0; i-- {
-        idx := indexes[i]
-        c.Inventory = append(c.Inventory[:idx], c.Inventory[idx+1:]...)
+}
+
+// Equipe un objet de l'inventaire et range l'ancienne piece du meme emplacement
+func (c *Character) equip(idx int) bool {
+    if idx < 0 || idx >= len(c.Inventory) {
+        return false
+    }
+    def := items[c.Inventory[idx].ID]
+    if def.Slot == "" {
+        fmt.Println("Cet objet ne s'equipe pas.")
+        return false
+    }
+    piece := c.Inventory.takeAt(idx)
+    if prev, ok := c.Equipment[def.Slot]; ok {
+        c.Inventory.put(prev)
+        fmt.Printf("%s retire %s.\n", c.Name, stackLabel(prev))
+    }
+    c.Equipment[def.Slot] = piece
+    oldHP, oldMana := c.MaxHP, c.MaxMana
+    c.refreshStats()
+    if c.MaxHP > oldHP {
+        c.HP += c.MaxHP - oldHP
+    }
+    if c.MaxMana > oldMana {
+        c.Mana += c.MaxMana - oldMana
+    }
+    fmt.Printf("%s equipe %s (%s).\n", c.Name, stackLabel(piece), slotNames[def.Slot])
+    return true
+}
+
+// Retire la piece d'un emplacement et la range dans la sacoche
+func (c *Character) unequip(slot string) bool {
+    piece, ok := c.Equipment[slot]
+    if !ok {
+        fmt.Println("Rien n'est porte a cet emplacement.")
+        return false
+    }
+    if !c.Inventory.fits(piece, c.InventoryMax) {
+        fmt.Println("Votre sacoche est pleine.")
+        return false
     }
+    c.Inventory.put(piece)
+    delete(c.Equipment, slot)
+    c.refreshStats()
+    fmt.Printf("%s retire %s.\n", c.Name, stackLabel(piece))
     return true
 }
 
 // Ajoute de l'experience et gere les montees de niveau
 func (c *Character) gainXP(amount int) {
+    if xpToNext(c.Level) == 0 {
+        return
+    }
     c.XP += amount
-    for c.XP >= 100 {
-        c.XP -= 100
+    for need := xpToNext(c.Level); need > 0 && c.XP >= need; need = xpToNext(c.Level) {
+        c.XP -= need
         c.Level++
-        c.MaxHP += 6
-        c.MaxMana += 4
+        grow := c.growth()
+        oldHP, oldMana := c.MaxHP, c.MaxMana
+        c.BaseMaxHP += grow.HP
+        c.BaseMaxMana += grow.Mana
+        c.SkillPoints++
+        c.refreshStats()
         c.HP = c.MaxHP
         c.Mana = c.MaxMana
-        fmt.Printf("%s passe niveau %d !\n", c.Name, c.Level)
+        fmt.Printf("%s passe niveau %d ! HP max %d -> %d (+%d) | MP max %d -> %d (+%d) | +1 point de competence\n", c.Name, c.Level, oldHP, c.MaxHP, c.MaxHP-oldHP, oldMana, c.MaxMana, c.MaxMana-oldMana)
+        c.announceTraits()
+    }
+    if xpToNext(c.Level) == 0 {
+        c.XP = 0
+        fmt.Printf("%s atteint le niveau maximal.\n", c.Name)
     }
 }
 
-// Reanime un personnage a moitie de sa vie si necessaire
-func (c *Character) reviveIfNeeded() {
+// Reanime un personnage selon la difficulte et la renommee de la region du combat
+func (g *Game) reviveIfNeeded(c *Character) {
+    if g.Ironman {
+        return
+    }
     if c.HP <= 0 {
-        heal := c.MaxHP / 2
+        region := g.region
+        if region == "" {
+            region = regionNeonopolis
+        }
+        ratio := math.Min(g.difficulty().ReviveRatio*reviveScale(g.Fame[region].Fame), 1)
+        heal := int(float64(c.MaxHP) * ratio)
         if heal < 1 {
             heal = 1
         }
         c.HP = heal
         c.ShieldHP = 0
-        fmt.Printf("Les fans relevent %s (%d HP).\n", c.Name, c.HP)
+        fmt.Printf("Les fans de %s relevent %s (%d HP).\n", regionNames[region], c.Name, c.HP)
     }
 }
 
@@ -712,7 +2041,11 @@ func (c *Character) resetCombatFlags() {
 // Affiche les caracteristiques du personnage actif
 func (c *Character) printStats() {
     fmt.Printf("\n%s [%s] - Niveau %d\n", c.Name, c.Class, c.Level)
-    fmt.Printf("HP: %d/%d | Mana: %d/%d | XP: %d/100\n", c.HP, c.MaxHP, c.Mana, c.MaxMana, c.XP)
+    xp := "MAX"
+    if need := xpToNext(c.Level); need > 0 {
+        xp = fmt.Sprintf("%d/%d", c.XP, need)
+    }
+    fmt.Printf("HP: %d/%d | Mana: %d/%d | XP: %s\n", c.HP, c.MaxHP, c.Mana, c.MaxMana, xp)
     fmt.Printf("Points de mise: %d | Inventaire: %d/%d\n", c.BetPts, len(c.Inventory), c.InventoryMax)
     if c.ShieldHP > 0 {
         fmt.Printf("Bouclier actif: %d HP absorbables\n", c.ShieldHP)
@@ -722,6 +2055,21 @@ func (c *Character) printStats() {
     } else {
         fmt.Println("Sort appris: aucun")
     }
+    c.printTraits()
+    c.printEquipment()
+}
+
+// Affiche l'equipement porte emplacement par emplacement
+func (c *Character) printEquipment() {
+    fmt.Println("-- Equipement --")
+    for i, slot := range equipSlots {
+        label := "(vide)"
+        if piece, ok := c.Equipment[slot]; ok {
+            label = fmt.Sprintf("%s - %s", stackLabel(piece), gearBonusLabel(piece))
+        }
+        fmt.Printf("%d) %s: %s\n", i+1, slotNames[slot], label)
+    }
+    c.printSets()
 }
 
 // Construit une nouvelle partie ou recharge une sauvegarde
@@ -730,14 +2078,31 @@ func newGame(sm *SaveManager, profile string, state *SaveState) *Game {
         rng:            rand.New(rand.NewSource(time.Now().UnixNano())),
         saver:          sm,
         profile:        profile,
-        merchantItems: []string{"potion_hp", "potion_mana", "potion_poison", "grimoire_note", "bag_upgrade"},
-        materialItems: []string{"mat_loup", "mat_troll", "mat_sanglier", "mat_corb"},
-        boostItems:    []string{"boost_x2", "boost_x4"},
         recipes:       recipes,
+        sessionStart:   time.Now(),
+        rewardWaiting:  map[string]bool{},
+        Crafted:        map[string]int{},
+        Achievements:   map[string]time.Time{},
+        QuestProgress:  map[string]int{},
+        Bestiary:       map[string]BestiaryEntry{},
+        Endings:        map[string]int{},
+        Fame:           map[string]RegionFame{},
+    }
+    for _, id := range itemOrder {
+        def := items[id]
+        switch {
+        case def.Type == itemMaterial:
+            g.materialItems = append(g.materialItems, id)
+        case !def.Sold:
+        case def.Type == itemBoost:
+            g.boostItems = append(g.boostItems, id)
+        default:
+            g.merchantItems = append(g.merchantItems, id)
+        }
     }
     if state == nil {
         g.Characters = []*Character{
-            {Name: "Hatsune Miku", Class: "Digital Idol", MaxHP: 80, HP: 80, MaxMana: 40, Mana: 40, Level: 1, BetPts: 30, Inventory: []string{"potion_hp", "potion_hp", "potion_hp"}, InventoryMax: 12, Unlocked: true},
+            {Name: "Hatsune Miku", Class: "Digital Idol", MaxHP: 80, HP: 80, MaxMana: 40, Mana: 40, Level: 1, BetPts: 30, Inventory: Inventory{{ID: "potion_hp", Qty: 3}}, InventoryMax: 12, Unlocked: true},
             {Name: "Kaaris", Class: "Force de la Rue", MaxHP: 120, HP: 120, MaxMana: 30, Mana: 30, Level: 1, InventoryMax: 12, Unlocked: false},
             {Name: "Emmanuel Macron", Class: "Strategie Presidentielle", MaxHP: 100, HP: 100, MaxMana: 35, Mana: 35, Level: 1, InventoryMax: 12, Unlocked: false},
             {Name: "Michael Jackson", Class: "Roi de la Pop", MaxHP: 100, HP: 100, MaxMana: 35, Mana: 35, Level: 1, InventoryMax: 12, Unlocked: false},
@@ -747,18 +2112,27 @@ func newGame(sm *SaveManager, profile string, state *SaveState) *Game {
             zoneKaaris:  {Unlocked: true},
             zoneMacron:  {Unlocked: false},
         }
+        for _, ch := range g.Characters {
+            ch.normalize()
+        }
         g.Flags = map[string]bool{}
+        g.KnownRecipes = map[string]bool{}
         g.TrainingBaseHP = 24
         g.TrainingBaseAtk = 5
         g.Gold = 15
         g.StoryStage = stagePrologue
+        g.Difficulty = difficultyNormal
         return g
     }
+    g.Difficulty = difficulties[difficultyRank(state.Difficulty)].ID
+    g.Ironman = state.Ironman
+    g.Locked = state.Locked
     g.PlayerIndex = state.PlayerIndex
     g.Characters = make([]*Character, len(state.Characters))
     for i := range state.Characters {
         ch := state.Characters[i]
         ch.resetCombatFlags()
+        ch.normalize()
         g.Characters[i] = &ch
     }
     g.StoryStage = state.StoryStage
@@ -776,10 +2150,37 @@ func newGame(sm *SaveManager, profile string, state *SaveState) *Game {
     g.FarmLevel = state.FarmLevel
     g.CraftUnlocked = state.CraftUnlocked
     g.Gold = state.Gold
+    g.Bets = state.Bets
+    g.Stash = state.Stash
+    g.StashSealed = state.StashSealed
+    g.Shop = state.Shop
     g.Flags = state.Flags
     if g.Flags == nil {
         g.Flags = map[string]bool{}
     }
+    g.KnownRecipes = state.KnownRecipes
+    if g.KnownRecipes == nil {
+        g.KnownRecipes = map[string]bool{}
+    }
+    g.CraftXP = state.CraftXP
+    if state.Crafted != nil {
+        g.Crafted = state.Crafted
+    }
+    g.Wins = state.Wins
+    if state.Achievements != nil {
+        g.Achievements = state.Achievements
+    }
+    g.PlayTime = state.PlayTime
+    if state.QuestProgress != nil {
+        g.QuestProgress = state.QuestProgress
+    }
+    g.Cycle = state.Cycle
+    if state.Bestiary != nil {
+        g.Bestiary = state.Bestiary
+    }
+    if state.Endings != nil {
+        g.Endings = state.Endings
+    }
     g.ZoneStatus = state.ZoneStatus
     if g.ZoneStatus == nil {
         g.ZoneStatus = map[string]ZoneStatus{}
@@ -793,6 +2194,21 @@ func newGame(sm *SaveManager, profile string, state *SaveState) *Game {
     if _, ok := g.ZoneStatus[zoneMacron]; !ok {
         g.ZoneStatus[zoneMacron] = ZoneStatus{Unlocked: false}
     }
+    // Les anciennes sauvegardes n'ont pas les drapeaux d'histoire des quetes principales
+    for zone, flag := range map[string]string{zoneMichael: "mj_recrute", zoneKaaris: "kaaris_recrute", zoneMacron: "macron_recrute"} {
+        if g.ZoneStatus[zone].Completed {
+            g.Flags[flag] = true
+        }
+    }
+    if g.StoryStage >= stageFinish {
+        g.Flags["cassette_recuperee"] = true
+    }
+    g.Battles = state.Battles
+    if state.Fame != nil {
+        g.Fame = state.Fame
+    } else {
+        g.seedFame()
+    }
     return g
 }
 
@@ -806,6 +2222,9 @@ func (g *Game) snapshot() SaveState {
     }
     return SaveState{
         ProfileName:     g.profile,
+        Difficulty:      g.Difficulty,
+        Ironman:         g.Ironman,
+        Locked:          g.Locked,
         PlayerIndex:     g.PlayerIndex,
         Characters:      chars,
         StoryStage:      g.StoryStage,
@@ -817,6 +2236,22 @@ func (g *Game) snapshot() SaveState {
         Gold:            g.Gold,
         Flags:           g.Flags,
         ZoneStatus:      g.ZoneStatus,
+        Bets:            g.Bets,
+        Stash:           g.Stash,
+        StashSealed:     g.StashSealed,
+        Shop:            g.Shop,
+        KnownRecipes:    g.KnownRecipes,
+        CraftXP:         g.CraftXP,
+        Crafted:         g.Crafted,
+        Wins:            g.Wins,
+        Achievements:    g.Achievements,
+        PlayTime:        g.playTime(),
+        QuestProgress:   g.QuestProgress,
+        Cycle:           g.Cycle,
+        Bestiary:        g.Bestiary,
+        Endings:         g.Endings,
+        Fame:            g.Fame,
+        Battles:         g.Battles,
     }
 }
 
@@ -832,925 +2267,4419 @@ func (g *Game) autoSave() {
     }
 }
 
-// Recupere le personnage actuellement controle
-func (g *Game) active() *Character {
-    if g.PlayerIndex < 0 || g.PlayerIndex >= len(g.Characters) {
-        g.PlayerIndex = 0
-    }
-    return g.Characters[g.PlayerIndex]
-}
-
-// Donne un materiau aleatoire en recompense
-func (g *Game) rewardMaterial(target *Character) {
-    pool := append([]string{}, g.materialItems...)
-    if len(pool) == 0 {
+// Sauvegarde silencieuse apres chaque action en mode ironman
+func (g *Game) checkpoint() {
+    if !g.Ironman || g.Locked || g.saver == nil {
         return
     }
-    id := pool[g.rng.Intn(len(pool))]
-    if target.addItem(id) {
-        fmt.Printf("Vous obtenez %s.\n", items[id].Name)
+    if err := g.saver.save(g.snapshot()); err != nil {
+        fmt.Println("[Warn] sauvegarde impossible:", err)
     }
 }
 
-// Interface d'utilisation des objets en combat
-func (g *Game) useInventory(reader *bufio.Reader, user *Character, soloEnemy *Enemy, group []Enemy) bool {
-    if len(user.Inventory) == 0 {
-        fmt.Println("Votre sacoche est vide.")
-        return false
-    }
-    fmt.Println("\n=== Inventaire ===")
-    for i, id := range user.Inventory {
-        if def, ok := items[id]; ok {
-            fmt.Printf("%d) %s - %s\n", i+1, def.Name, def.Description)
-        } else {
-            fmt.Printf("%d) %s\n", i+1, id)
+// Indique si tous les personnages recrutes sont KO
+func (g *Game) partyWiped() bool {
+    for _, ch := range g.party() {
+        if ch.HP > 0 {
+            return false
         }
     }
-    fmt.Println("0) Retour")
-    fmt.Print("Choix: ")
-    choice, err := strconv.Atoi(read(reader))
-    if g.consumeMenuReturn() {
-        return false
-    }
-    if err != nil || choice < 0 || choice > len(user.Inventory) {
-        fmt.Println("Choix invalide.")
-        return false
+    return true
+}
+
+// Construit l'entree de hall of fame de la course en cours
+func (g *Game) hallOfFameRecord(cause string, victory bool) HallOfFameRecord {
+    rec := HallOfFameRecord{
+        Profile:    g.profile,
+        Difficulty: g.difficulty().Name,
+        StoryStage: g.StoryStage,
+        Allies:     len(g.party()) - 1,
+        Gold:       g.Gold,
+        Cause:      cause,
+        Victory:    victory,
+        Cycle:      g.Cycle,
+        EndedAt:    time.Now(),
     }
-    if choice == 0 {
-        return false
+    for _, ch := range g.Characters {
+        if ch.Level > rec.MaxLevel {
+            rec.MaxLevel = ch.Level
+        }
     }
-    idx := choice - 1
-    id := user.Inventory[idx]
-    def := items[id]
-    requiresTarget := false
-    switch def.EffectID {
-    case effDiscHater, effDiscCrew, effDiscPoison, effCrew:
-        requiresTarget = true
+    return rec
+}
+
+// Termine une course ironman si toute l'equipe est tombee
+func (g *Game) checkIronmanWipe(cause string) {
+    if !g.Ironman || g.Locked || !g.partyWiped() {
+        return
     }
-    var target *Enemy
-    if requiresTarget {
-        if soloEnemy != nil {
-            target = soloEnemy
-        } else {
-            alive := 0
-            for i := range group {
-                if group[i].HP > 0 {
-                    alive++
-                }
-            }
-            if alive == 0 {
-                fmt.Println("Aucun adversaire valide pour cet objet.")
-                return false
-            }
-            tgt, abort := selectEnemy(reader, group)
-            if abort {
-                return false
-            }
-            if tgt == nil {
-                fmt.Println("Cible invalide.")
-                return false
-            }
-            target = tgt
+    banner("Fin de la course ironman")
+    fmt.Println("Toute l'equipe est a terre. Les fans rentrent chez eux en silence.")
+    fmt.Printf("Course arretee a l'etape: %s.\n", stageName(g.StoryStage))
+    if g.saver != nil {
+        if err := g.saver.recordHallOfFame(g.hallOfFameRecord(cause, false)); err != nil {
+            fmt.Println("[Warn] hall of fame indisponible:", err)
         }
-    } else {
-        target = soloEnemy
-    }
-    if !applyItem(g, user, target, id) {
-        return false
     }
-    user.Inventory = append(user.Inventory[:idx], user.Inventory[idx+1:]...)
-    return true
+    g.Locked = true
+    g.autoSave()
+    g.menuReturnRequested = true
 }
 
+// Duree maximale pour le succes de sortie express
+const speedrunLimit = 2 * time.Hour
 
-// Menu d'achat chez le disquaire
-func (g *Game) handleMerchant(reader *bufio.Reader) {
-    fmt.Println("\n=== Disquaire independant ===")
-    listing := append([]string{}, g.merchantItems...)
-    listing = append(listing, g.materialItems...)
-    listing = append(listing, g.boostItems...)
-    active := g.active()
-    fmt.Printf("Or: %d | Points de mise: %d\n", g.Gold, active.BetPts)
-    for i, id := range listing {
-        def := items[id]
-        price := ""
-        if def.Price > 0 {
-            price = fmt.Sprintf("%d or", def.Price)
-        }
-        if def.BetPointCost > 0 {
-            if price != "" {
-                price += " + "
+// Les quatre disques forgeables
+var discItems = []string{"disc_loup", "disc_troll", "disc_sanglier", "disc_corb"}
+
+// Succes d'un profil; Goal > 0 pour les succes progressifs
+type achievement struct {
+    ID          string
+    Name        string
+    Description string
+    Goal        int
+    Progress    func(g *Game) int
+}
+
+var achievements = []achievement{
+    {ID: "label_sans_ko", Name: "Sans une egratignure", Description: "Terminer le label Pouler.fr sans aucun allie KO"},
+    {ID: "pari_x4", Name: "Tapis", Description: "Gagner un pari au palier x4"},
+    {ID: "miku_vs_kaaris", Name: "Seule contre la rue", Description: "Battre Kaaris en duel avec Miku"},
+    {ID: "sortie_express", Name: "Sortie express", Description: "Terminer l'histoire en moins de 2 heures de jeu"},
+    {ID: "producteur_fantome", Name: "Fantome du studio", Description: "Vaincre le boss secret du New Game+"},
+    {ID: "discographie", Name: "Discographie complete", Description: "Forger les quatre disques", Goal: len(discItems), Progress: func(g *Game) int {
+        n := 0
+        for _, id := range discItems {
+            if g.Crafted[id] > 0 {
+                n++
             }
-            price += fmt.Sprintf("%d pts mise", def.BetPointCost)
-        }
-        if price == "" {
-            price = "gratuit"
         }
-        fmt.Printf("%d) %s - %s (%s)\n", i+1, def.Name, def.Description, price)
-    }
-    fmt.Println("0) Retour")
-    fmt.Print("Choix: ")
-    choice, err := strconv.Atoi(read(reader))
-    if g.consumeMenuReturn() {
-        return
-    }
-    if err != nil || choice <= 0 || choice > len(listing) {
-        fmt.Println("Pas d'achat.")
+        return n
+    }},
+    {ID: "quatuor", Name: "Quatuor legendaire", Description: "Recruter Kaaris, Macron et Michael Jackson", Goal: 3, Progress: func(g *Game) int {
+        return len(g.party()) - 1
+    }},
+    {ID: "tournee", Name: "Tournee des stades", Description: "Remporter 100 combats", Goal: 100, Progress: func(g *Game) int {
+        return g.Wins
+    }},
+    {ID: "habitue", Name: "Habitue du guichet", Description: "Gagner 10 paris", Goal: 10, Progress: func(g *Game) int {
+        return g.Bets.Won
+    }},
+    {ID: "toutes_les_fins", Name: "Toutes les versions", Description: "Voir toutes les fins de l'histoire", Goal: len(endings), Progress: func(g *Game) int {
+        return len(g.Endings)
+    }},
+    {ID: "maitre_forge", Name: "Maitre de forge", Description: "Atteindre le niveau de forge maximal", Goal: craftMaxLevel, Progress: func(g *Game) int {
+        return g.craftLevel()
+    }},
+}
+
+// Temps de jeu cumule, session en cours comprise
+func (g *Game) playTime() time.Duration {
+    return g.PlayTime + time.Since(g.sessionStart)
+}
+
+// Debloque un succes pour le profil et le note dans le fichier global
+func (g *Game) unlockAchievement(id string) {
+    if _, done := g.Achievements[id]; done {
         return
     }
-    id := listing[choice-1]
-    def := items[id]
-    if def.Price > 0 && g.Gold < def.Price {
-        fmt.Println("Vous n'avez pas assez de fans (or).")
+    for _, a := range achievements {
+        if a.ID != id {
+            continue
+        }
+        g.Achievements[id] = time.Now()
+        fmt.Printf("*** Succes debloque: %s ***\n", a.Name)
+        if g.saver != nil {
+            if err := g.saver.recordGlobalAchievement(id, g.profile); err != nil {
+                fmt.Println("[Warn] succes globaux indisponibles:", err)
+            }
+        }
         return
     }
-    if def.BetPointCost > 0 && active.BetPts < def.BetPointCost {
-        fmt.Println("Points de mise insuffisants.")
-        return
+}
+
+// Debloque les succes progressifs dont l'objectif est atteint
+func (g *Game) checkAchievements() {
+    for _, a := range achievements {
+        if a.Goal > 0 && a.Progress(g) >= a.Goal {
+            g.unlockAchievement(a.ID)
+        }
     }
-    if !active.addItem(id) {
-        return
+}
+
+// Barre de progression texte, ex: [######----]
+func progressBar(cur, goal, width int) string {
+    if cur > goal {
+        cur = goal
     }
-    g.Gold -= def.Price
-    active.BetPts -= def.BetPointCost
-    if active.BetPts < 0 {
-        active.BetPts = 0
+    filled := 0
+    if goal > 0 {
+        filled = cur * width / goal
     }
-    fmt.Printf("Vous achetez %s.\n", def.Name)
+    return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
 }
 
-// Convertit les identifiants d'ingredients en noms affichables
-func recipeInputs(ids []string) []string {
-    out := make([]string, len(ids))
-    for i, id := range ids {
-        if def, ok := items[id]; ok {
-            out[i] = def.Name
-        } else {
-            out[i] = id
+// Liste les succes du profil avec leur progression et leur rarete entre profils
+func (g *Game) achievementsScreen() {
+    banner("Succes")
+    var global map[string]GlobalAchievement
+    if g.saver != nil {
+        records, err := g.saver.loadGlobalAchievements()
+        if err != nil {
+            fmt.Println("[Warn] succes globaux indisponibles:", err)
+        }
+        global = records
+    }
+    played := g.playTime()
+    fmt.Printf("Profil: %d/%d | Tous profils: %d/%d | Temps de jeu: %dh%02d\n", len(g.Achievements), len(achievements), len(global), len(achievements), int(played.Hours()), int(played.Minutes())%60)
+    for _, a := range achievements {
+        mark := "[ ]"
+        if _, done := g.Achievements[a.ID]; done {
+            mark = "[X]"
+        }
+        fmt.Printf("%s %s - %s\n", mark, a.Name, a.Description)
+        details := []string{}
+        if at, done := g.Achievements[a.ID]; done {
+            details = append(details, "obtenu le "+at.Format("02/01/2006"))
+        } else if a.Goal > 0 {
+            cur := a.Progress(g)
+            details = append(details, fmt.Sprintf("%s %d/%d", progressBar(cur, a.Goal, 10), min(cur, a.Goal), a.Goal))
+        }
+        if n := len(global[a.ID].Profiles); n > 0 {
+            details = append(details, fmt.Sprintf("obtenu sur %d profil(s)", n))
+        }
+        if len(details) > 0 {
+            fmt.Println("    " + strings.Join(details, " | "))
         }
     }
-    return out
 }
 
-// Menu de craft et de fabrication
-func (g *Game) handleCraft(reader *bufio.Reader) {
-    if !g.CraftUnlocked {
-        fmt.Println("Le forgeron Spartan n'est pas disponible pour l'instant.")
-        return
-    }
-    fmt.Println("\n=== Atelier Spartan ===")
-    active := g.active()
-    fmt.Printf("Or: %d\n", g.Gold)
-    for i, rec := range g.recipes {
-        fmt.Printf("%d) %s - besoin: %s | cout %d\n", i+1, rec.Name, strings.Join(recipeInputs(rec.Inputs), ", "), rec.CraftCost)
+// Carnets du profil: succes, journal des quetes, bestiaire, fins et renommee
+func (g *Game) notebooks(reader *bufio.Reader) {
+    for {
+        banner("Carnets")
+        fmt.Println("1) Succes")
+        fmt.Println("2) Journal des quetes")
+        fmt.Println("3) Bestiaire")
+        fmt.Println("4) Galerie des fins")
+        fmt.Println("5) Renommee")
+        fmt.Println("0) Retour")
+        fmt.Print("Choix: ")
+        choice := read(reader)
+        if g.consumeMenuReturn() {
+            return
+        }
+        switch choice {
+        case "1":
+            g.achievementsScreen()
+        case "2":
+            g.questJournal()
+        case "3":
+            g.bestiaryScreen(reader)
+        case "4":
+            g.endingGallery()
+        case "5":
+            g.fameScreen()
+        case "0", "":
+            return
+        default:
+            fmt.Println("Choix invalide.")
+        }
     }
-    fmt.Println("0) Retour")
-    fmt.Print("Choix: ")
-    choice, err := strconv.Atoi(read(reader))
-    if g.consumeMenuReturn() {
-        return
+}
+
+// Types d'objectifs de quete
+const (
+    objectiveFlag   = "flag"
+    objectiveDefeat = "defeat"
+    objectiveBring  = "bring"
+    objectiveDuel   = "duel"
+)
+
+// Lieux ou se trouvent les donneurs de quetes
+var questZones = map[string]string{
+    "hub":       "Carte du monde sonore",
+    zoneMichael: "Neonopolis Pop",
+    zoneKaaris:  "Banlieue Rugueuse",
+    zoneMacron:  "Palais presidentiel",
+    "label":     "QG du label",
+}
+
+var questZoneOrder = []string{"hub", zoneMichael, zoneKaaris, zoneMacron, "label"}
+
+// Objectif d'une quete: drapeau d'histoire, ennemis a vaincre, objets a rapporter ou duel sans objet
+type QuestObjective struct {
+    Kind      string
+    Flag      string
+    EnemyType EnemyType
+    Enemy     string
+    Item      string
+    Count     int
+}
+
+// Quete principale ou annexe
+type QuestDefinition struct {
+    ID          string
+    Name        string
+    Description string
+    Main        bool
+    MinStage    storyStage
+    Giver       string
+    Zone        string
+    Requires    string
+    Objective   QuestObjective
+    RewardGold  int
+    RewardXP    int
+    RewardItem  string
+    RewardQty   int
+}
+
+// Quetes du jeu (chargees depuis data/quests.json)
+var quests []QuestDefinition
+
+// Liste les incoherences d'une quete
+func checkQuest(q QuestDefinition, catalog map[string]ItemDefinition, ids map[string]bool) []string {
+    problems := []string{}
+    obj := q.Objective
+    switch obj.Kind {
+    case objectiveFlag:
+        if obj.Flag == "" {
+            problems = append(problems, "objectif flag sans Flag")
+        }
+    case objectiveDefeat:
+        if obj.EnemyType != "" && !knownEnemyType(obj.EnemyType) {
+            problems = append(problems, fmt.Sprintf("type d'ennemi inconnu %q", obj.EnemyType))
+        }
+    case objectiveBring:
+        if _, ok := catalog[obj.Item]; !ok {
+            problems = append(problems, fmt.Sprintf("objet a rapporter inconnu %q", obj.Item))
+        }
+    case objectiveDuel:
+    default:
+        problems = append(problems, fmt.Sprintf("objectif inconnu %q", obj.Kind))
     }
-    if err != nil || choice <= 0 || choice > len(g.recipes) {
-        fmt.Println("Aucun craft.")
-        return
+    if obj.Kind != objectiveFlag && obj.Count <= 0 {
+        problems = append(problems, "Count doit etre positif")
     }
-    rec := g.recipes[choice-1]
-    if g.Gold < rec.CraftCost {
-        fmt.Println("Or insuffisant.")
-        return
+    if !q.Main {
+        if q.Giver == "" {
+            problems = append(problems, "quete annexe sans Giver")
+        }
+        if _, ok := questZones[q.Zone]; !ok {
+            problems = append(problems, fmt.Sprintf("zone inconnue %q", q.Zone))
+        }
     }
-    if !active.removeItems(rec.Inputs) {
-        fmt.Println("Il vous manque des materiaux.")
-        return
+    if q.Requires != "" && !ids[q.Requires] {
+        problems = append(problems, fmt.Sprintf("quete requise inconnue %q", q.Requires))
     }
-    if !active.addItem(rec.OutputID) {
-        fmt.Println("Inventaire plein, craft annule.")
-        for _, id := range rec.Inputs {
-            active.addItem(id)
+    if q.RewardItem != "" {
+        if _, ok := catalog[q.RewardItem]; !ok {
+            problems = append(problems, fmt.Sprintf("objet de recompense inconnu %q", q.RewardItem))
+        }
+        if q.RewardQty <= 0 {
+            problems = append(problems, "RewardQty doit etre positif")
         }
-        return
     }
-    g.Gold -= rec.CraftCost
-    fmt.Printf("Vous forgez %s.\n", rec.Name)
+    return problems
 }
 
-// Pose une question a choix multiples au joueur
-func (g *Game) dialogueChoice(reader *bufio.Reader, prompt string, options []string) (int, bool) {
-    for {
-        fmt.Println(prompt)
-        for i, opt := range options {
-            fmt.Printf("%d) %s\n", i+1, opt)
-        }
-        fmt.Print("Reponse: ")
-        input := read(reader)
-        if g.consumeMenuReturn() {
-            return 0, true
-        }
-        choice, err := strconv.Atoi(input)
-        if err == nil && choice >= 1 && choice <= len(options) {
-            return choice - 1, false
-        }
-        fmt.Println("Choix invalide.")
-    }
+// Etat des quetes, stocke dans les drapeaux du profil
+func (g *Game) questActive(id string) bool {
+    return g.Flags["quete:"+id] && !g.Flags["quete_finie:"+id]
 }
 
-// Scene d'introduction et tutoriel
-func (g *Game) prologue(reader *bufio.Reader) {
-    banner("Chapitre 0 - Cassette volee")
-    block(reader,
+func (g *Game) questDone(id string) bool {
+    return g.Flags["quete_finie:"+id]
+}
+
+// Indique si un lieu de quetes est accessible
+func (g *Game) questZoneOpen(zone string) bool {
+    switch zone {
+    case "hub":
+        return g.StoryStage > stagePrologue
+    case "label":
+        return g.StoryStage >= stageLabel
+    }
+    return g.ZoneStatus[zone].Unlocked
+}
+
+// Quetes qu'un habitant peut proposer maintenant
+func (g *Game) questOffers(giver string) []QuestDefinition {
+    offers := []QuestDefinition{}
+    for _, q := range quests {
+        if q.Main || q.Giver != giver || g.Flags["quete:"+q.ID] {
+            continue
+        }
+        if g.StoryStage < int(q.MinStage) || (q.Requires != "" && !g.questDone(q.Requires)) {
+            continue
+        }
+        offers = append(offers, q)
+    }
+    return offers
+}
+
+// Progression d'une quete active, ex: 3/5
+func (g *Game) questProgress(q QuestDefinition) (int, int) {
+    switch q.Objective.Kind {
+    case objectiveFlag:
+        if g.Flags[q.Objective.Flag] {
+            return 1, 1
+        }
+        return 0, 1
+    case objectiveBring:
+        c := g.active()
+        return c.Inventory.count(q.Objective.Item) + g.Stash.count(q.Objective.Item), q.Objective.Count
+    }
+    return g.QuestProgress[q.ID], q.Objective.Count
+}
+
+// Accepte une quete
+func (g *Game) startQuest(q QuestDefinition) {
+    g.Flags["quete:"+q.ID] = true
+    kind := "annexe"
+    if q.Main {
+        kind = "principale"
+    }
+    fmt.Printf("Nouvelle quete %s: %s - %s\n", kind, q.Name, q.Description)
+}
+
+// Indique si l'objet de recompense d'une quete trouve sa place (sacoche ou coffre)
+func (g *Game) questRewardFits(q QuestDefinition) bool {
+    if q.RewardItem == "" {
+        return true
+    }
+    return g.canReceive(g.active(), []ItemStack{{ID: q.RewardItem, Qty: q.RewardQty}})
+}
+
+// Termine une quete et verse ses recompenses
+func (g *Game) completeQuest(q QuestDefinition) {
+    g.Flags["quete_finie:"+q.ID] = true
+    delete(g.QuestProgress, q.ID)
+    delete(g.rewardWaiting, q.ID)
+    fmt.Printf("*** Quete terminee: %s ***\n", q.Name)
+    c := g.active()
+    if q.RewardGold > 0 {
+        g.Gold += q.RewardGold
+        fmt.Printf("Recompense: +%d or\n", q.RewardGold)
+    }
+    if q.RewardXP > 0 {
+        fmt.Printf("Recompense: +%d XP pour %s\n", q.RewardXP, c.Name)
+        c.gainXP(q.RewardXP)
+    }
+    if q.RewardItem != "" {
+        for _, st := range g.rollInstance(q.RewardItem, q.RewardQty) {
+            fmt.Printf("Recompense: %s\n", stackLabel(st))
+            g.deliver(c, st)
+        }
+    }
+}
+
+// Ouvre les quetes principales et valide les objectifs remplis
+func (g *Game) updateQuests() {
+    for _, q := range quests {
+        if q.Main && !g.Flags["quete:"+q.ID] && g.StoryStage >= int(q.MinStage) {
+            g.startQuest(q)
+        }
+        if !g.questActive(q.ID) || q.Objective.Kind == objectiveBring {
+            continue
+        }
+        if cur, goal := g.questProgress(q); cur < goal {
+            continue
+        }
+        if !g.questRewardFits(q) {
+            if !g.rewardWaiting[q.ID] {
+                g.rewardWaiting[q.ID] = true
+                fmt.Printf("Quete %s accomplie: faites de la place (sacoche ou coffre) pour recevoir %s.\n", q.Name, questRewardLabel(q))
+            }
+            continue
+        }
+        g.completeQuest(q)
+    }
+}
+
+// Compte les ennemis vaincus pour les quetes de chasse
+func (g *Game) questKills(enemies []Enemy) {
+    for _, q := range quests {
+        obj := q.Objective
+        if obj.Kind != objectiveDefeat || !g.questActive(q.ID) {
+            continue
+        }
+        for _, e := range enemies {
+            if e.HP > 0 || (obj.EnemyType != "" && e.Type != obj.EnemyType) || (obj.Enemy != "" && e.Name != obj.Enemy) {
+                continue
+            }
+            g.QuestProgress[q.ID]++
+        }
+    }
+    g.updateQuests()
+}
+
+// Note un duel gagne pour les quetes de duel sans objet
+func (g *Game) questDuel(enemy Enemy, usedItems bool) {
+    for _, q := range quests {
+        obj := q.Objective
+        if obj.Kind != objectiveDuel || usedItems || !g.questActive(q.ID) {
+            continue
+        }
+        if (obj.EnemyType != "" && enemy.Type != obj.EnemyType) || (obj.Enemy != "" && enemy.Name != obj.Enemy) {
+            continue
+        }
+        g.QuestProgress[q.ID]++
+    }
+}
+
+// Remet les objets demandes par une quete de livraison
+func (g *Game) turnInQuest(q QuestDefinition) bool {
+    if cur, goal := g.questProgress(q); cur < goal {
+        fmt.Printf("Il vous faut encore %d %s.\n", goal-cur, items[q.Objective.Item].Name)
+        return false
+    }
+    if !g.questRewardFits(q) {
+        fmt.Println("Sacoche et coffre pleins: faites de la place pour recevoir la recompense.")
+        return false
+    }
+    c := g.active()
+    left := q.Objective.Count
+    for left > 0 && c.Inventory.count(q.Objective.Item) > 0 {
+        c.Inventory.remove(q.Objective.Item, 1)
+        left--
+    }
+    if left > 0 {
+        g.Stash.remove(q.Objective.Item, left)
+    }
+    g.completeQuest(q)
+    return true
+}
+
+// Habitants des lieux accessibles et leurs quetes annexes
+func (g *Game) townsfolk(reader *bufio.Reader) {
+    for {
+        banner("Habitants")
+        type npc struct {
+            name string
+            zone string
+        }
+        people := []npc{}
+        for _, zone := range questZoneOrder {
+            if !g.questZoneOpen(zone) {
+                continue
+            }
+            for _, q := range quests {
+                if q.Main || q.Zone != zone || slices.Contains(people, npc{q.Giver, zone}) {
+                    continue
+                }
+                people = append(people, npc{q.Giver, zone})
+            }
+        }
+        if len(people) == 0 {
+            fmt.Println("Personne n'a de travail a confier pour l'instant.")
+            return
+        }
+        for i, p := range people {
+            mark := ""
+            if len(g.questOffers(p.name)) > 0 {
+                mark = " (!)"
+            }
+            for _, q := range quests {
+                if q.Giver == p.name && q.Objective.Kind == objectiveBring && g.questActive(q.ID) {
+                    if cur, goal := g.questProgress(q); cur >= goal {
+                        mark = " (?)"
+                    }
+                }
+            }
+            fmt.Printf("%d) %s - %s%s\n", i+1, p.name, questZones[p.zone], mark)
+        }
+        patrol := 0
+        if g.ZoneStatus[zoneKaaris].Completed {
+            patrol = len(people) + 1
+            fmt.Printf("%d) Ronde avec le crew - %s (combat repetable)\n", patrol, questZones[zoneKaaris])
+        }
+        fmt.Println("0) Retour")
+        fmt.Print("Choix: ")
+        choice, err := strconv.Atoi(read(reader))
+        if g.consumeMenuReturn() {
+            return
+        }
+        if err != nil || choice < 0 || (choice > len(people) && choice != patrol) {
+            fmt.Println("Choix invalide.")
+            continue
+        }
+        if choice == 0 {
+            return
+        }
+        if choice == patrol {
+            g.crewPatrol(reader)
+            if g.consumeMenuReturn() {
+                return
+            }
+            continue
+        }
+        g.talkTo(reader, people[choice-1].name)
+    }
+}
+
+// Ronde repetable dans la Banlieue: les guetteurs appellent du renfort
+func (g *Game) crewPatrol(reader *bufio.Reader) {
+    if g.fightParty(reader, g.party(), []Enemy{{Name: "Guetteur du hall", Type: enemyCrew, MaxHP: 30, HP: 30, Attack: 5, CritTimer: 3, Style: "Rue"}}, battleOptions{
+        Region:      regionBanlieue,
+        AllowEscape: true,
+        Intro:       []string{"Le grand frere du quartier: \"Fais le tour des halls, ils squattent encore la cage d'escalier.\""},
+        Victory:     []string{"Les guetteurs decampent. Le quartier respire."},
+        RewardXP:    12,
+        RewardGold:  3,
+        Reinforcements: []reinforcementWave{
+            {Round: 2, Call: "Le guetteur siffle entre ses doigts: le parking repond.", Enemies: []Enemy{
+                {Name: "Guetteur du parking", Type: enemyCrew, MaxHP: 22, HP: 22, Attack: 4, CritTimer: 3, Style: "Rue"},
+                {Name: "Guetteur du hall", Type: enemyCrew, MaxHP: 22, HP: 22, Attack: 4, CritTimer: 3, Style: "Rue"},
+            }, RewardXP: 8, RewardGold: 2},
+        },
+        MaxOnField: 2,
+    }) {
+        g.autoSave()
+    }
+}
+
+// Discussion avec un habitant: livraison puis nouvelles quetes
+func (g *Game) talkTo(reader *bufio.Reader, giver string) {
+    for _, q := range quests {
+        if q.Giver != giver || !g.questActive(q.ID) {
+            continue
+        }
+        cur, goal := g.questProgress(q)
+        if q.Objective.Kind == objectiveBring && cur >= goal {
+            fmt.Printf("%s: \"Tu as ce qu'il me faut pour \"%s\" ?\"\n", giver, q.Name)
+            fmt.Print("Remettre les objets ? (o/n): ")
+            answer := strings.ToLower(read(reader))
+            if g.consumeMenuReturn() {
+                return
+            }
+            if answer == "o" {
+                g.turnInQuest(q)
+            }
+            continue
+        }
+        fmt.Printf("%s: \"Alors, \"%s\" ? (%d/%d)\"\n", giver, q.Name, min(cur, goal), goal)
+    }
+    offers := g.questOffers(giver)
+    if len(offers) == 0 {
+        fmt.Printf("%s: \"Rien de neuf pour toi.\"\n", giver)
+        return
+    }
+    q := offers[0]
+    fmt.Printf("%s: \"%s\"\n", giver, q.Description)
+    fmt.Printf("Recompense: %s\n", questRewardLabel(q))
+    fmt.Print("Accepter la quete ? (o/n): ")
+    answer := strings.ToLower(read(reader))
+    if g.consumeMenuReturn() {
+        return
+    }
+    if answer == "o" {
+        g.startQuest(q)
+    }
+}
+
+// Resume des recompenses d'une quete
+func questRewardLabel(q QuestDefinition) string {
+    parts := []string{}
+    if q.RewardGold > 0 {
+        parts = append(parts, fmt.Sprintf("%d or", q.RewardGold))
+    }
+    if q.RewardXP > 0 {
+        parts = append(parts, fmt.Sprintf("%d XP", q.RewardXP))
+    }
+    if q.RewardItem != "" {
+        parts = append(parts, fmt.Sprintf("%s x%d", items[q.RewardItem].Name, q.RewardQty))
+    }
+    if len(parts) == 0 {
+        return "la gratitude du public"
+    }
+    return strings.Join(parts, ", ")
+}
+
+// Journal des quetes actives et terminees
+func (g *Game) questJournal() {
+    banner("Journal des quetes")
+    for _, done := range []bool{false, true} {
+        if done {
+            fmt.Println("-- Terminees --")
+        } else {
+            fmt.Println("-- En cours --")
+        }
+        shown := 0
+        for _, q := range quests {
+            if (done && !g.questDone(q.ID)) || (!done && !g.questActive(q.ID)) {
+                continue
+            }
+            shown++
+            kind := "Annexe"
+            if q.Main {
+                kind = "Principale"
+            }
+            if done {
+                fmt.Printf("[%s] %s\n", kind, q.Name)
+                continue
+            }
+            cur, goal := g.questProgress(q)
+            fmt.Printf("[%s] %s - %s\n", kind, q.Name, q.Description)
+            if g.rewardWaiting[q.ID] {
+                fmt.Println("    Objectif rempli: faites de la place pour recevoir la recompense.")
+            }
+            if q.Main {
+                fmt.Printf("    Recompense: %s\n", questRewardLabel(q))
+            } else {
+                fmt.Printf("    %s %d/%d | %s (%s) | Recompense: %s\n", progressBar(cur, goal, 10), min(cur, goal), goal, q.Giver, questZones[q.Zone], questRewardLabel(q))
+            }
+        }
+        if shown == 0 {
+            fmt.Println("Aucune.")
+        }
+    }
+}
+
+// Fiche de bestiaire d'un ennemi, remplie au fil des combats
+type BestiaryEntry struct {
+    Type     EnemyType
+    Style    string
+    MaxHP    int
+    Attack   int
+    Seen     int
+    Defeated int
+    Observed int
+}
+
+// Ennemis du scenario dans l'ordre d'apparition
+var bestiaryRoster = []string{
+    "Hater de studio", "Hater d'entrainement", "Gardien repetitif", "Bot viral", "Haineux de quartier",
+    "Guetteur du hall", "Guetteur du parking", "Duel avec Kaaris", "Division strategique",
+    "Megurine Luka", "Kagamine Rin", "Kagamine Len", "KAITO", "Avocat du label", "Huissier du label",
+    "Mattieu Berger", "Sylvain Bagland", "Producteur fantome", "Echo du studio",
+}
+
+var enemyTypeNames = map[EnemyType]string{
+    enemyHater: "Hater",
+    enemyCrew:  "Crew",
+    enemyRival: "Rivale",
+    enemyBoss:  "Boss",
+    enemyFarm:  "Farm",
+}
+
+// Ce que revele chaque palier de connaissance
+var knowledgeLabels = []string{"inconnu", "apercu", "statistiques et style", "faiblesses", "butin"}
+
+// Palier de connaissance atteint (0 a 4)
+func (b BestiaryEntry) knowledge() int {
+    switch {
+    case b.Seen == 0:
+        return 0
+    case b.Defeated >= 5 || (b.Defeated >= 1 && b.Observed >= 3):
+        return 4
+    case b.Defeated >= 3 || b.Observed >= 2:
+        return 3
+    case b.Defeated >= 1 || b.Observed >= 1:
+        return 2
+    }
+    return 1
+}
+
+// Annonce un nouveau palier de connaissance
+func (g *Game) announceKnowledge(name string, before int) {
+    if after := g.Bestiary[name].knowledge(); after > before {
+        fmt.Printf("Bestiaire: %s - nouvelles infos (%s).\n", name, knowledgeLabels[after])
+    }
+}
+
+// Note l'entree en combat d'un ennemi
+func (g *Game) noteEncounter(e Enemy) {
+    entry := g.Bestiary[e.Name]
+    before := entry.knowledge()
+    entry.Type, entry.Style = e.Type, e.Style
+    entry.MaxHP, entry.Attack = e.MaxHP, e.Attack
+    entry.Seen++
+    g.Bestiary[e.Name] = entry
+    if before == 0 {
+        fmt.Printf("Bestiaire: nouvelle fiche pour %s.\n", e.Name)
+    }
+}
+
+// Note les ennemis vaincus a la fin d'un combat gagne
+func (g *Game) noteDefeats(enemies []Enemy) {
+    for _, e := range enemies {
+        if e.HP > 0 {
+            continue
+        }
+        entry := g.Bestiary[e.Name]
+        before := entry.knowledge()
+        entry.Defeated++
+        g.Bestiary[e.Name] = entry
+        g.announceKnowledge(e.Name, before)
+    }
+}
+
+// Action Observer: enregistre l'ennemi et ce que l'observation revele
+func (g *Game) observe(e Enemy) {
+    if g.observed[e.Name] {
+        fmt.Printf("%s deja etudie pendant ce combat.\n", e.Name)
+        return
+    }
+    g.observed[e.Name] = true
+    entry := g.Bestiary[e.Name]
+    before := entry.knowledge()
+    entry.Observed++
+    g.Bestiary[e.Name] = entry
+    g.announceKnowledge(e.Name, before)
+}
+
+// Objets efficaces contre un type d'ennemi
+func weaknessesOf(t EnemyType) []string {
+    found := []string{}
+    for _, id := range itemOrder {
+        def := items[id]
+        for _, step := range def.Effects {
+            if (step.Bonus > 0 && step.BonusType == t) || (t == enemyBoss && step.Status == statusGuardBreak) {
+                found = append(found, def.Name)
+                break
+            }
+        }
+    }
+    return found
+}
+
+// Objets que peut laisser un ennemi
+func dropsOf(name string, t EnemyType) []string {
+    table := lootTableFor(Enemy{Name: name, Type: t})
+    if table == nil {
+        return nil
+    }
+    found := []string{}
+    for _, group := range [][]LootDrop{table.Guaranteed, table.Drops, table.Rare} {
+        for _, d := range group {
+            if !slices.Contains(found, items[d.Item].Name) {
+                found = append(found, items[d.Item].Name)
+            }
+        }
+    }
+    return found
+}
+
+// Noms du bestiaire: ennemis du scenario puis ennemis rencontres hors liste
+func (g *Game) bestiaryNames() []string {
+    names := slices.Clone(bestiaryRoster)
+    extra := []string{}
+    for name := range g.Bestiary {
+        if !slices.Contains(names, name) {
+            extra = append(extra, name)
+        }
+    }
+    sort.Strings(extra)
+    return append(names, extra...)
+}
+
+// Bestiaire du profil avec taux de completion et fiches detaillees
+func (g *Game) bestiaryScreen(reader *bufio.Reader) {
+    for {
+        banner("Bestiaire")
+        names := g.bestiaryNames()
+        known, met := 0, 0
+        for _, name := range names {
+            k := g.Bestiary[name].knowledge()
+            known += k
+            if k > 0 {
+                met++
+            }
+        }
+        fmt.Printf("Completion: %d%% | Ennemis rencontres: %d/%d\n", known*100/(len(names)*(len(knowledgeLabels)-1)), met, len(names))
+        for i, name := range names {
+            entry := g.Bestiary[name]
+            if entry.Seen == 0 {
+                fmt.Printf("%d) ???\n", i+1)
+                continue
+            }
+            fmt.Printf("%d) %s [%s] vu %d | vaincu %d | %s\n", i+1, name, enemyTypeNames[entry.Type], entry.Seen, entry.Defeated, progressBar(entry.knowledge(), len(knowledgeLabels)-1, 4))
+        }
+        fmt.Println("0) Retour")
+        fmt.Print("Fiche a consulter: ")
+        choice, err := strconv.Atoi(read(reader))
+        if g.consumeMenuReturn() {
+            return
+        }
+        if err != nil || choice < 0 || choice > len(names) {
+            fmt.Println("Choix invalide.")
+            continue
+        }
+        if choice == 0 {
+            return
+        }
+        g.printBestiaryEntry(names[choice-1])
+    }
+}
+
+// Fiche detaillee, limitee a ce que le profil a deja decouvert
+func (g *Game) printBestiaryEntry(name string) {
+    entry := g.Bestiary[name]
+    k := entry.knowledge()
+    if k == 0 {
+        fmt.Println("Ennemi jamais rencontre.")
+        return
+    }
+    fmt.Printf("\n-- %s --\n", name)
+    fmt.Printf("Type: %s | Rencontres: %d | Vaincus: %d | Observations: %d\n", enemyTypeNames[entry.Type], entry.Seen, entry.Defeated, entry.Observed)
+    if k >= 2 {
+        fmt.Printf("Style: %s | HP max: %d | ATK: %d (derniere rencontre)\n", entry.Style, entry.MaxHP, entry.Attack)
+    } else {
+        fmt.Println("Statistiques: ??? (vaincre ou observer une fois)")
+    }
+    if k >= 3 {
+        weak := weaknessesOf(entry.Type)
+        if len(weak) == 0 {
+            weak = []string{"aucune connue"}
+        }
+        fmt.Println("Faiblesses: " + strings.Join(weak, ", "))
+    } else {
+        fmt.Println("Faiblesses: ??? (3 victoires ou 2 observations)")
+    }
+    if k >= 4 {
+        drops := dropsOf(name, entry.Type)
+        if len(drops) == 0 {
+            drops = []string{"rien"}
+        }
+        fmt.Println("Butin: " + strings.Join(drops, ", "))
+    } else {
+        fmt.Println("Butin: ??? (5 victoires, ou 1 victoire et 3 observations)")
+    }
+}
+
+// Recupere le personnage actuellement controle
+func (g *Game) active() *Character {
+    if g.PlayerIndex < 0 || g.PlayerIndex >= len(g.Characters) {
+        g.PlayerIndex = 0
+    }
+    return g.Characters[g.PlayerIndex]
+}
+
+// Reglages de la difficulte du profil
+func (g *Game) difficulty() difficultySettings {
+    return difficulties[difficultyRank(g.Difficulty)]
+}
+
+// Adapte un ennemi a la difficulte du profil
+func (g *Game) scaleEnemy(e *Enemy) {
+    d := g.difficulty()
+    cycle := g.cycleFactor(ngPlusEnemyScale)
+    e.MaxHP = int(math.Round(float64(e.MaxHP) * d.EnemyHP * cycle))
+    e.HP = e.MaxHP
+    e.Attack = int(math.Round(float64(e.Attack) * d.EnemyAttack * cycle))
+    e.CritEvery = max(e.CritTimer+d.CritShift, 1)
+    e.CritTimer = e.CritEvery
+}
+
+// Adapte une recompense (or ou XP) a la difficulte et au cycle de New Game+
+func (g *Game) scaleReward(amount int) int {
+    return int(math.Round(float64(amount) * g.difficulty().Rewards * g.cycleFactor(ngPlusRewardScale)))
+}
+
+// Prix d'un objet chez le marchand selon la difficulte
+func (g *Game) priceOf(def ItemDefinition) int {
+    if def.Price <= 0 {
+        return 0
+    }
+    price := int(math.Round(float64(def.Price) * g.difficulty().Prices))
+    if price < 1 {
+        price = 1
+    }
+    return price
+}
+
+// Objet pouvant tomber d'une table de butin
+type LootDrop struct {
+    Item   string
+    Weight int
+    Min    int
+    Max    int
+    Chance float64
+}
+
+// Table de butin d'un type d'ennemi ou d'un ennemi precis (Enemy prioritaire sur EnemyType)
+type LootTable struct {
+    ID         string
+    EnemyType  EnemyType
+    Enemy      string
+    GoldMin    int
+    GoldMax    int
+    Rolls      int
+    Drops      []LootDrop
+    Guaranteed []LootDrop
+    Rare       []LootDrop
+}
+
+// Tables de butin (chargees depuis data/loot.json)
+var lootTables []LootTable
+
+// Liste les incoherences d'une table de butin
+func checkLootTable(t LootTable, catalog map[string]ItemDefinition) []string {
+    problems := []string{}
+    if (t.Enemy == "") == (t.EnemyType == "") {
+        problems = append(problems, "renseigner Enemy ou EnemyType (un seul)")
+    }
+    if t.EnemyType != "" && !knownEnemyType(t.EnemyType) {
+        problems = append(problems, fmt.Sprintf("type d'ennemi inconnu %q", t.EnemyType))
+    }
+    if t.GoldMin < 0 || t.GoldMax < t.GoldMin {
+        problems = append(problems, "fourchette d'or invalide")
+    }
+    if t.Rolls < 0 || (t.Rolls > 0 && len(t.Drops) == 0) {
+        problems = append(problems, "Rolls demande une liste Drops")
+    }
+    check := func(list string, d LootDrop) {
+        if _, ok := catalog[d.Item]; !ok {
+            problems = append(problems, fmt.Sprintf("%s: objet inconnu %q", list, d.Item))
+        }
+        if d.Min < 0 || (d.Max > 0 && d.Max < d.Min) {
+            problems = append(problems, fmt.Sprintf("%s: quantites invalides pour %q", list, d.Item))
+        }
+    }
+    for _, d := range t.Drops {
+        check("Drops", d)
+        if d.Weight <= 0 {
+            problems = append(problems, fmt.Sprintf("Drops: poids manquant pour %q", d.Item))
+        }
+    }
+    for _, d := range t.Guaranteed {
+        check("Guaranteed", d)
+    }
+    for _, d := range t.Rare {
+        check("Rare", d)
+        if d.Chance <= 0 || d.Chance > 1 {
+            problems = append(problems, fmt.Sprintf("Rare: Chance doit etre entre 0 et 1 pour %q", d.Item))
+        }
+    }
+    return problems
+}
+
+// Table qui s'applique a un ennemi: la sienne en priorite, sinon celle de son type
+func lootTableFor(e Enemy) *LootTable {
+    var byType *LootTable
+    for i := range lootTables {
+        t := &lootTables[i]
+        if t.Enemy == e.Name {
+            return t
+        }
+        if t.EnemyType == e.Type && byType == nil {
+            byType = t
+        }
+    }
+    return byType
+}
+
+// Quantite tiree pour un objet (1 par defaut)
+func (g *Game) dropQty(d LootDrop) int {
+    lo := max(d.Min, 1)
+    hi := max(d.Max, lo)
+    return lo + g.rng.Intn(hi-lo+1)
+}
+
+// Tire le butin des ennemis vaincus; les objets identiques sont regroupes
+func (g *Game) rollLoot(enemies []Enemy) (int, Inventory) {
+    gold := 0
+    counts := map[string]int{}
+    order := []string{}
+    gain := func(d LootDrop) {
+        if counts[d.Item] == 0 {
+            order = append(order, d.Item)
+        }
+        counts[d.Item] += g.dropQty(d)
+    }
+    for _, e := range enemies {
+        t := lootTableFor(e)
+        if t == nil || e.HP > 0 {
+            continue
+        }
+        gold += t.GoldMin + g.rng.Intn(t.GoldMax-t.GoldMin+1)
+        for _, d := range t.Guaranteed {
+            gain(d)
+        }
+        total := 0
+        for _, d := range t.Drops {
+            total += d.Weight
+        }
+        for r := 0; r < t.Rolls && total > 0; r++ {
+            pick := g.rng.Intn(total)
+            for _, d := range t.Drops {
+                if pick < d.Weight {
+                    gain(d)
+                    break
+                }
+                pick -= d.Weight
+            }
+        }
+        for _, d := range t.Rare {
+            if g.rng.Float64() < d.Chance {
+                gain(d)
+            }
+        }
+    }
+    loot := Inventory{}
+    for _, id := range order {
+        loot = append(loot, g.rollInstance(id, counts[id])...)
+    }
+    return g.scaleReward(gold), loot
+}
+
+// Affiche et distribue le butin de fin de combat
+func (g *Game) grantLoot(reader *bufio.Reader, c *Character, enemies []Enemy) {
+    gold, loot := g.rollLoot(enemies)
+    if gold == 0 && len(loot) == 0 {
+        return
+    }
+    fmt.Println("-- Butin --")
+    if gold > 0 {
+        g.Gold += gold
+        fmt.Printf("+%d or\n", gold)
+    }
+    for _, st := range loot {
+        fmt.Printf("- %s\n", stackLabel(st))
+    }
+    for _, st := range loot {
+        g.claimLoot(reader, c, st)
+    }
+}
+
+// Membre qui recoit le butin d'un combat d'equipe: le perso actif s'il a combattu
+func (g *Game) lootReceiver(party []*Character) *Character {
+    for _, ch := range party {
+        if ch == g.active() {
+            return ch
+        }
+    }
+    return party[0]
+}
+
+// Range un butin dans la sacoche, ou demande quoi faire si elle est pleine
+func (g *Game) claimLoot(reader *bufio.Reader, c *Character, st ItemStack) {
+    for {
+        if c.Inventory.fits(st, c.InventoryMax) {
+            c.Inventory.put(st)
+            return
+        }
+        fmt.Printf("Sacoche de %s pleine: que faire de %s ?\n", c.Name, stackLabel(st))
+        toStash := g.Stash.fits(st, stashMax)
+        if toStash {
+            fmt.Println("1) Envoyer au coffre d'equipe")
+        }
+        fmt.Println("2) Jeter un objet de la sacoche pour faire de la place")
+        fmt.Println("0) Laisser sur place")
+        fmt.Print("Choix: ")
+        choice := read(reader)
+        if g.consumeMenuReturn() {
+            fmt.Printf("%s reste sur place.\n", stackLabel(st))
+            return
+        }
+        switch {
+        case choice == "1" && toStash:
+            g.Stash.put(st)
+            fmt.Printf("%s part au coffre d'equipe.\n", stackLabel(st))
+            return
+        case choice == "2":
+            idx := g.pickStack(reader, "Objet a jeter:", c.Inventory)
+            if idx >= 0 {
+                g.discard(reader, c, idx)
+            }
+        case choice == "0":
+            fmt.Printf("%s reste sur place.\n", stackLabel(st))
+            return
+        default:
+            fmt.Println("Choix invalide.")
+        }
+    }
+}
+
+// Objet d'histoire: special, sans valeur marchande, jamais jetable
+func storyItem(id string) bool {
+    return items[id].Type == itemSpecial && itemValue(id) == 0
+}
+
+// Jette une quantite choisie d'une pile de la sacoche apres confirmation
+func (g *Game) discard(reader *bufio.Reader, c *Character, idx int) {
+    st := c.Inventory[idx]
+    if storyItem(st.ID) {
+        fmt.Printf("%s est indispensable a l'histoire: impossible de le jeter.\n", items[st.ID].Name)
+        return
+    }
+    qty := g.askQuantity(reader, st.Qty)
+    if qty <= 0 {
+        return
+    }
+    thrown := st
+    thrown.Qty = qty
+    fmt.Printf("Jeter %s ? (o/n): ", stackLabel(thrown))
+    answer := strings.ToLower(read(reader))
+    if g.consumeMenuReturn() || answer != "o" {
+        fmt.Println("Rien n'est jete.")
+        return
+    }
+    c.Inventory.takeQty(idx, qty)
+    fmt.Printf("Vous jetez %s.\n", stackLabel(thrown))
+}
+
+// Interface d'utilisation des objets en combat (consommables et boosts uniquement)
+func (g *Game) useInventory(reader *bufio.Reader, user *Character, party []*Character, enemies []Enemy, withStash bool) bool {
+    type entry struct {
+        bag *Inventory
+        idx int
+    }
+    view := []entry{}
+    for _, idx := range user.Inventory.filter(combatItemTypes...) {
+        view = append(view, entry{&user.Inventory, idx})
+    }
+    if withStash {
+        for _, idx := range g.Stash.filter(combatItemTypes...) {
+            view = append(view, entry{&g.Stash, idx})
+        }
+    }
+    if len(view) == 0 {
+        fmt.Println("Aucun objet utilisable en combat dans votre sacoche.")
+        return false
+    }
+    fmt.Println("\n=== Inventaire ===")
+    for i, e := range view {
+        st := (*e.bag)[e.idx]
+        origin := ""
+        if e.bag == &g.Stash {
+            origin = " [coffre]"
+        }
+        fmt.Printf("%d) %s%s - %s\n", i+1, stackLabel(st), origin, items[st.ID].Description)
+    }
+    fmt.Println("0) Retour")
+    fmt.Print("Choix: ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.menuReturnRequested {
+        return false
+    }
+    if err != nil || choice < 0 || choice > len(view) {
+        fmt.Println("Choix invalide.")
+        return false
+    }
+    if choice == 0 {
+        return false
+    }
+    picked := view[choice-1]
+    return g.useStack(reader, user, picked.bag, picked.idx, party, enemies)
+}
+
+// Utilise un exemplaire de la pile choisie sur la cible declaree par son effet
+func (g *Game) useStack(reader *bufio.Reader, user *Character, bag *Inventory, idx int, party []*Character, enemies []Enemy) bool {
+    id := (*bag)[idx].ID
+    spec := targetSpec{Kind: itemTargets[items[id].Target]}
+    targets, abort := g.resolveTargets(reader, spec, user, party, enemies)
+    if abort {
+        g.menuReturnRequested = true
+        return false
+    }
+    if targets.empty() {
+        return false
+    }
+    recipient := user
+    if len(targets.Allies) > 0 {
+        recipient = targets.Allies[0]
+    }
+    var target *Enemy
+    if len(targets.Enemies) > 0 {
+        target = targets.Enemies[0]
+    }
+    if !applyItem(g, recipient, target, (*bag)[idx]) {
+        return false
+    }
+    bag.takeAt(idx)
+    g.itemsUsed++
+    return true
+}
+
+// Sacoche hors combat: tri, filtre par type et utilisation
+func (g *Game) bagScreen(reader *bufio.Reader, c *Character) {
+    filterIdx := -1
+    for {
+        var view []int
+        title := "Tous"
+        if filterIdx >= 0 {
+            view = c.Inventory.filter(itemTypeOrder[filterIdx])
+            title = itemTypeNames[itemTypeOrder[filterIdx]]
+        } else {
+            view = c.Inventory.filter()
+        }
+        fmt.Printf("\n=== Sacoche de %s (%d/%d) - %s ===\n", c.Name, len(c.Inventory), c.InventoryMax, title)
+        if len(view) == 0 {
+            fmt.Println("(rien a afficher)")
+        }
+        for i, idx := range view {
+            st := c.Inventory[idx]
+            def := items[st.ID]
+            fmt.Printf("%d) %s [%s] - %s\n", i+1, stackLabel(st), itemTypeNames[def.Type], gearBonusLabel(st))
+        }
+        fmt.Println("T) Trier par type | N) Trier par nom | F) Changer de filtre | 0) Retour")
+        fmt.Print("Choix: ")
+        input := read(reader)
+        if g.consumeMenuReturn() {
+            return
+        }
+        switch strings.ToLower(input) {
+        case "0", "":
+            return
+        case "t":
+            c.Inventory.sortBy("type")
+        case "n":
+            c.Inventory.sortBy("name")
+        case "f":
+            filterIdx++
+            if filterIdx >= len(itemTypeOrder) {
+                filterIdx = -1
+            }
+        default:
+            choice, err := strconv.Atoi(input)
+            if err != nil || choice <= 0 || choice > len(view) {
+                fmt.Println("Choix invalide.")
+                continue
+            }
+            g.useStack(reader, c, &c.Inventory, view[choice-1], g.party(), nil)
+            if g.consumeMenuReturn() {
+                return
+            }
+        }
+    }
+}
+
+// Selectionne un allie vivant (ou KO) via le joueur
+func selectAlly(reader *bufio.Reader, party []*Character, knockedOut bool) (*Character, bool) {
+    candidates := []*Character{}
+    for _, ch := range party {
+        if ch != nil && (ch.HP <= 0) == knockedOut {
+            candidates = append(candidates, ch)
+        }
+    }
+    if len(candidates) == 0 {
+        return nil, false
+    }
+    if len(candidates) == 1 {
+        return candidates[0], false
+    }
+    for i, ch := range candidates {
+        status := "KO"
+        if ch.HP > 0 {
+            status = fmt.Sprintf("HP %d/%d | MP %d/%d", ch.HP, ch.MaxHP, ch.Mana, ch.MaxMana)
+        }
+        fmt.Printf("  %d) %s (%s)\n", i+1, ch.Name, status)
+    }
+    for {
+        fmt.Print("Allie (numero): ")
+        input := read(reader)
+        if activeGame != nil && activeGame.consumeMenuReturn() {
+            return nil, true
+        }
+        idx, err := strconv.Atoi(input)
+        if err != nil || idx <= 0 || idx > len(candidates) {
+            fmt.Println("Allie invalide.")
+            continue
+        }
+        return candidates[idx-1], false
+    }
+}
+
+
+// Nombre de combats entre deux arrivages chez le disquaire
+const restockEvery = 3
+
+// Etat du disquaire: stock restant, tendance des prix et compteur d'arrivage
+type ShopState struct {
+    Stock   map[string]int
+    Demand  map[string]int
+    Battles int
+}
+
+// Quantite livree a chaque arrivage
+func defaultStock(def ItemDefinition) int {
+    if def.Stock > 0 {
+        return def.Stock
+    }
+    switch def.Type {
+    case itemConsumable:
+        return 5
+    case itemMaterial:
+        return 8
+    case itemBoost:
+        return 2
+    default:
+        return 1
+    }
+}
+
+// Multiplicateur de prix selon les achats (+) et ventes (-) recents
+func demandFactor(demand int) float64 {
+    return math.Max(0.7, math.Min(1.6, 1+0.08*float64(demand)))
+}
+
+// Remise accordee par les fans, en pourcentage (1% tous les 10 points de renommee totale, 20% max)
+func fanDiscount(fame int) int {
+    return min(fame/10, 20)
+}
+
+// Compte un combat termine pour le prochain arrivage et l'usure de la renommee
+func (g *Game) noteBattle() {
+    g.Shop.Battles++
+    g.Battles++
+    g.decayFame()
+}
+
+// Regions ou se construit la renommee de Miku
+const (
+    regionNeonopolis = "neonopolis"
+    regionBanlieue   = "banlieue"
+    regionPalais     = "palais"
+    regionQG         = "qg"
+)
+
+var regionOrder = []string{regionNeonopolis, regionBanlieue, regionPalais, regionQG}
+
+var regionNames = map[string]string{
+    regionNeonopolis: "Neonopolis",
+    regionBanlieue:   "Banlieue",
+    regionPalais:     "Palais",
+    regionQG:         "QG",
+}
+
+// Renommee maximale d'une region, combats sans y jouer avant que les fans decrochent
+const (
+    fameMax     = 100
+    fameNeglect = 8
+)
+
+// Renommee d'une region et combat ou elle a ete entretenue pour la derniere fois
+type RegionFame struct {
+    Fame       int
+    LastActive int
+}
+
+// Palier de scene debloque par la renommee totale (ouvre de nouveaux articles chez le disquaire)
+type fameTier struct {
+    Name string
+    Fame int
+}
+
+var fameTiers = []fameTier{
+    {Name: "Scene de quartier", Fame: 0},
+    {Name: "Club", Fame: 60},
+    {Name: "Salle de concert", Fame: 140},
+    {Name: "Stade", Fame: 240},
+}
+
+// Region d'un combat (le hub compte pour Neonopolis)
+func (opts battleOptions) region() string {
+    if opts.Region == "" {
+        return regionNeonopolis
+    }
+    return opts.Region
+}
+
+// Renommee gagnee par une victoire (les boss comptent davantage)
+func victoryFame(opts battleOptions) int {
+    if opts.IsBoss {
+        return 8
+    }
+    return 2
+}
+
+// Renommee cumulee sur toutes les regions
+func (g *Game) totalFame() int {
+    total := 0
+    for _, r := range g.Fame {
+        total += r.Fame
+    }
+    return total
+}
+
+// Nombre de fans d'une region (croissance plus rapide quand la renommee s'installe)
+func fansOf(fame int) int {
+    return fame * (fame + 20) * 5
+}
+
+// Nombre total de fans affiche dans le menu
+func (g *Game) fans() int {
+    total := 0
+    for _, r := range g.Fame {
+        total += fansOf(r.Fame)
+    }
+    return total
+}
+
+// Palier de scene atteint avec la renommee totale
+func (g *Game) fameTier() int {
+    total, tier := g.totalFame(), 0
+    for i, t := range fameTiers {
+        if total >= t.Fame {
+            tier = i
+        }
+    }
+    return tier
+}
+
+// Ajoute de la renommee a une region et annonce un nouveau palier de scene
+func (g *Game) gainFame(region string, points int) {
+    if points <= 0 {
+        return
+    }
+    before := g.fameTier()
+    r := g.Fame[region]
+    r.Fame = min(r.Fame+points, fameMax)
+    r.LastActive = g.Battles
+    g.Fame[region] = r
+    fmt.Printf("Renommee %s +%d (%d/%d).\n", regionNames[region], points, r.Fame, fameMax)
+    if tier := g.fameTier(); tier > before {
+        fmt.Printf("*** Nouveau palier de scene: %s ! Le disquaire elargit son catalogue. ***\n", fameTiers[tier].Name)
+    }
+}
+
+// Les regions delaissees perdent un point de renommee par combat joue ailleurs
+func (g *Game) decayFame() {
+    for _, region := range regionOrder {
+        r, ok := g.Fame[region]
+        if !ok || r.Fame == 0 {
+            continue
+        }
+        idle := g.Battles - r.LastActive
+        if idle <= fameNeglect {
+            continue
+        }
+        if idle == fameNeglect+1 {
+            fmt.Printf("Les fans de %s se sentent delaisses et commencent a decrocher.\n", regionNames[region])
+        }
+        r.Fame--
+        g.Fame[region] = r
+    }
+}
+
+// Renommee de depart des anciennes sauvegardes, deduite de l'histoire deja jouee
+func (g *Game) seedFame() {
+    for flag, beat := range storyFame {
+        if g.Flags[flag] {
+            r := g.Fame[beat.Region]
+            r.Fame = min(r.Fame+beat.Fame, fameMax)
+            r.LastActive = g.Battles
+            g.Fame[beat.Region] = r
+        }
+    }
+}
+
+// Moments d'histoire qui font parler d'eux dans une region
+type fameBeat struct {
+    Region string
+    Fame   int
+}
+
+var storyFame = map[string]fameBeat{
+    "mj_recrute":         {Region: regionNeonopolis, Fame: 15},
+    "kaaris_recrute":     {Region: regionBanlieue, Fame: 15},
+    "macron_recrute":     {Region: regionPalais, Fame: 15},
+    "cassette_recuperee": {Region: regionQG, Fame: 25},
+    "producteur_vaincu":  {Region: regionNeonopolis, Fame: 10},
+}
+
+// Marque un moment d'histoire et la renommee qu'il rapporte
+func (g *Game) storyBeat(flag string) {
+    g.Flags[flag] = true
+    if beat, ok := storyFame[flag]; ok {
+        g.gainFame(beat.Region, beat.Fame)
+    }
+}
+
+// Force du rappel des fans selon la renommee locale (x0.6 a x1.4)
+func reviveScale(fame int) float64 {
+    return 0.6 + 0.8*float64(fame)/fameMax
+}
+
+// Ecran de renommee par region
+func (g *Game) fameScreen() {
+    banner("Renommee")
+    tier := g.fameTier()
+    fmt.Printf("Fans: %d | Renommee totale: %d | Scene: %s\n", g.fans(), g.totalFame(), fameTiers[tier].Name)
+    if tier+1 < len(fameTiers) {
+        next := fameTiers[tier+1]
+        fmt.Printf("Prochain palier: %s a %d de renommee totale.\n", next.Name, next.Fame)
+    }
+    for _, region := range regionOrder {
+        r := g.Fame[region]
+        status := ""
+        if r.Fame > 0 && g.Battles-r.LastActive > fameNeglect {
+            status = " (delaissee)"
+        }
+        fmt.Printf("%-11s %s %3d/%d | %d fans | rappel x%.1f%s\n", regionNames[region], progressBar(r.Fame, fameMax, 10), r.Fame, fameMax, fansOf(r.Fame), reviveScale(r.Fame), status)
+    }
+}
+
+// Objets proposes selon l'avancement de l'histoire, les zones terminees et le palier de scene
+func (g *Game) shopOffers() []string {
+    listing := append([]string{}, g.merchantItems...)
+    listing = append(listing, g.materialItems...)
+    listing = append(listing, g.boostItems...)
+    out := []string{}
+    for _, id := range listing {
+        def := items[id]
+        if g.StoryStage < int(def.MinStage) || g.fameTier() < def.FameTier {
+            continue
+        }
+        if def.Zone != "" && !g.ZoneStatus[def.Zone].Completed {
+            continue
+        }
+        out = append(out, id)
+    }
+    return out
+}
+
+// Exemplaires restants d'un objet jusqu'au prochain arrivage (un de plus par palier de scene, sauf objets rares)
+func (g *Game) stockOf(id string) int {
+    if qty, ok := g.Shop.Stock[id]; ok {
+        return qty
+    }
+    if def := items[id]; def.Stock == 0 {
+        return defaultStock(def) + g.fameTier()
+    }
+    return defaultStock(items[id])
+}
+
+// Remet le stock a neuf et calme les tendances de prix
+func (g *Game) restockShop() {
+    g.Shop.Stock = map[string]int{}
+    g.Shop.Battles = 0
+    for id, d := range g.Shop.Demand {
+        g.Shop.Demand[id] = d / 2
+        if g.Shop.Demand[id] == 0 {
+            delete(g.Shop.Demand, id)
+        }
+    }
+}
+
+// Prix d'achat apres tendance et remise fan
+func (g *Game) buyPrice(id string) int {
+    base := g.priceOf(items[id])
+    if base == 0 {
+        return 0
+    }
+    price := float64(base) * demandFactor(g.Shop.Demand[id]) * float64(100-fanDiscount(g.totalFame())-g.traitDiscount()) / 100
+    return max(int(math.Round(price)), 1)
+}
+
+// Valeur de reference d'un objet (prix catalogue, ou ingredients + facon s'il se fabrique)
+func itemValue(id string) int {
+    if def := items[id]; def.Price > 0 {
+        return def.Price
+    }
+    for _, rec := range recipes {
+        if rec.OutputID != id {
+            continue
+        }
+        value := rec.CraftCost
+        for _, in := range rec.Inputs {
+            value += items[in].Price
+        }
+        return value
+    }
+    return 0
+}
+
+// Prix de reprise: 40% de la valeur, suivant la tendance du marche (0 = invendable)
+func (g *Game) sellPrice(id string) int {
+    value := itemValue(id)
+    if value == 0 {
+        return 0
+    }
+    price := float64(value) * g.difficulty().Prices * demandFactor(g.Shop.Demand[id]) * 0.4
+    return max(int(math.Round(price)), 1)
+}
+
+// Prix de reprise d'un exemplaire, majore de 25% par niveau d'amelioration
+func (g *Game) stackSellPrice(st ItemStack) int {
+    price := g.sellPrice(st.ID)
+    price = int(math.Round(float64(price) * rarityOf(st.Rarity).Value))
+    return price + price*st.Upgrade/4
+}
+
+// Indique la tendance du prix d'un objet
+func trendLabel(demand int) string {
+    switch {
+    case demand > 0:
+        return ", en hausse"
+    case demand < 0:
+        return ", en baisse"
+    default:
+        return ""
+    }
+}
+
+// Menu du disquaire: achat, revente et arrivages
+func (g *Game) handleMerchant(reader *bufio.Reader) {
+    if g.Shop.Stock == nil || g.Shop.Battles >= restockEvery {
+        if g.Shop.Stock != nil {
+            fmt.Println("\nNouvel arrivage chez le disquaire !")
+        }
+        g.restockShop()
+    }
+    if g.Shop.Demand == nil {
+        g.Shop.Demand = map[string]int{}
+    }
+    for {
+        fmt.Println("\n=== Disquaire independant ===")
+        fmt.Printf("Or: %d | Points de mise: %d | Arrivage dans %d combat(s)\n", g.Gold, g.active().BetPts, restockEvery-g.Shop.Battles)
+        fmt.Printf("Scene: %s (%d fans, remise fan %d%%)\n", fameTiers[g.fameTier()].Name, g.fans(), fanDiscount(g.totalFame()))
+        fmt.Println("1) Acheter")
+        fmt.Println("2) Vendre")
+        fmt.Println("0) Retour")
+        fmt.Print("Choix: ")
+        choice := read(reader)
+        if g.consumeMenuReturn() {
+            return
+        }
+        switch choice {
+        case "1":
+            g.merchantBuy(reader)
+        case "2":
+            g.merchantSell(reader)
+        case "0", "":
+            return
+        default:
+            fmt.Println("Choix invalide.")
+        }
+        if g.menuReturnRequested {
+            return
+        }
+    }
+}
+
+// Achat d'un ou plusieurs exemplaires dans le stock du moment
+func (g *Game) merchantBuy(reader *bufio.Reader) {
+    listing := g.shopOffers()
+    active := g.active()
+    for i, id := range listing {
+        def := items[id]
+        price := ""
+        if cost := g.buyPrice(id); cost > 0 {
+            price = fmt.Sprintf("%d or", cost)
+        }
+        if def.BetPointCost > 0 {
+            if price != "" {
+                price += " + "
+            }
+            price += fmt.Sprintf("%d pts mise", def.BetPointCost)
+        }
+        if price == "" {
+            price = "gratuit"
+        }
+        stock := fmt.Sprintf("stock %d", g.stockOf(id))
+        if g.stockOf(id) == 0 {
+            stock = "epuise"
+        }
+        fmt.Printf("%d) %s - %s (%s%s) [%s]\n", i+1, def.Name, def.Description, price, trendLabel(g.Shop.Demand[id]), stock)
+    }
+    fmt.Println("0) Retour")
+    fmt.Print("Choix: ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() {
+        return
+    }
+    if err != nil || choice <= 0 || choice > len(listing) {
+        fmt.Println("Pas d'achat.")
+        return
+    }
+    id := listing[choice-1]
+    def := items[id]
+    if g.stockOf(id) == 0 {
+        fmt.Println("Rupture de stock: revenez apres le prochain arrivage.")
+        return
+    }
+    qty := g.askQuantity(reader, g.stockOf(id))
+    if qty <= 0 {
+        return
+    }
+    cost := g.buyPrice(id) * qty
+    if g.Gold < cost {
+        fmt.Println("Vous n'avez pas assez de fans (or).")
+        return
+    }
+    if def.BetPointCost > 0 && active.BetPts < def.BetPointCost*qty {
+        fmt.Println("Points de mise insuffisants.")
+        return
+    }
+    if !active.addItems(id, qty) {
+        return
+    }
+    g.Gold -= cost
+    active.BetPts = max(active.BetPts-def.BetPointCost*qty, 0)
+    g.Shop.Stock[id] = g.stockOf(id) - qty
+    g.Shop.Demand[id] += qty
+    fmt.Printf("Vous achetez %s pour %d or.\n", stackLabel(ItemStack{ID: id, Qty: qty}), cost)
+}
+
+// Revente d'objets de la sacoche du personnage actif
+func (g *Game) merchantSell(reader *bufio.Reader) {
+    active := g.active()
+    view := []int{}
+    for i, st := range active.Inventory {
+        if g.sellPrice(st.ID) > 0 {
+            view = append(view, i)
+        }
+    }
+    if len(view) == 0 {
+        fmt.Println("Le disquaire ne rachete rien de ce que vous portez.")
+        return
+    }
+    for i, idx := range view {
+        st := active.Inventory[idx]
+        fmt.Printf("%d) %s - %d or piece%s\n", i+1, stackLabel(st), g.stackSellPrice(st), trendLabel(g.Shop.Demand[st.ID]))
+    }
+    fmt.Println("0) Retour")
+    fmt.Print("Choix: ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() {
+        return
+    }
+    if err != nil || choice <= 0 || choice > len(view) {
+        return
+    }
+    st := active.Inventory[view[choice-1]]
+    qty := g.askQuantity(reader, st.Qty)
+    if qty <= 0 {
+        return
+    }
+    gain := g.stackSellPrice(st) * qty
+    active.Inventory.takeQty(view[choice-1], qty)
+    g.Gold += gain
+    g.Shop.Demand[st.ID] -= qty
+    if _, listed := g.Shop.Stock[st.ID]; listed {
+        g.Shop.Stock[st.ID] += qty
+    }
+    sold := st
+    sold.Qty = qty
+    fmt.Printf("Vous vendez %s pour %d or.\n", stackLabel(sold), gain)
+}
+
+// Convertit les identifiants d'ingredients en noms affichables
+func recipeInputs(ids []string) []string {
+    out := make([]string, len(ids))
+    for i, id := range ids {
+        if def, ok := items[id]; ok {
+            out[i] = def.Name
+        } else {
+            out[i] = id
+        }
+    }
+    return out
+}
+
+// Noms des ingredients avec la quantite disponible (sacoche + coffre)
+func (g *Game) recipeStock(c *Character, ids []string) []string {
+    needed := map[string]int{}
+    order := []string{}
+    for _, id := range ids {
+        if needed[id] == 0 {
+            order = append(order, id)
+        }
+        needed[id]++
+    }
+    out := make([]string, 0, len(order))
+    for _, id := range order {
+        name := recipeInputs([]string{id})[0]
+        out = append(out, fmt.Sprintf("%s %d/%d", name, c.Inventory.count(id)+g.Stash.count(id), needed[id]))
+    }
+    return out
+}
+
+// Niveau de forge maximal et experience par niveau
+const (
+    craftMaxLevel = 5
+    craftXPStep   = 10
+)
+
+// Niveau de forge tire de l'experience d'artisan
+func (g *Game) craftLevel() int {
+    return min(1+g.CraftXP/craftXPStep, craftMaxLevel)
+}
+
+// Cout de fabrication reduit de 10% par niveau de forge au-dela du premier
+func (g *Game) craftCost(rec RecipeDefinition) int {
+    return rec.CraftCost * (100 - 10*(g.craftLevel()-1)) / 100
+}
+
+// Ajoute de l'experience d'artisan et annonce les niveaux gagnes
+func (g *Game) gainCraftXP(amount int) {
+    before := g.craftLevel()
+    g.CraftXP += amount
+    if after := g.craftLevel(); after > before {
+        fmt.Printf("Niveau de forge %d ! Recettes avancees et couts reduits.\n", after)
+    }
+}
+
+// Recettes affichees: publiques et secretes deja decouvertes
+func (g *Game) visibleRecipes() []RecipeDefinition {
+    out := []RecipeDefinition{}
+    for _, rec := range g.recipes {
+        if !rec.Hidden || g.KnownRecipes[rec.ID] {
+            out = append(out, rec)
+        }
+    }
+    return out
+}
+
+// Cle d'un melange d'ingredients, independante de l'ordre
+func comboKey(ids []string) string {
+    sorted := append([]string{}, ids...)
+    sort.Strings(sorted)
+    return strings.Join(sorted, "+")
+}
+
+// Menu de craft et de fabrication
+func (g *Game) handleCraft(reader *bufio.Reader) {
+    if !g.CraftUnlocked {
+        fmt.Println("Le forgeron Spartan n'est pas disponible pour l'instant.")
+        return
+    }
+    fmt.Println("\n=== Atelier Spartan ===")
+    active := g.active()
+    fmt.Printf("Or: %d | Niveau de forge %d (%d XP)\n", g.Gold, g.craftLevel(), g.CraftXP)
+    list := g.visibleRecipes()
+    for i, rec := range list {
+        tag := ""
+        if rec.Hidden {
+            tag = " [secret]"
+        }
+        if rec.Skill > g.craftLevel() {
+            tag += fmt.Sprintf(" (forge niv. %d requise)", rec.Skill)
+        }
+        fmt.Printf("%d) %s%s - besoin: %s | cout %d\n", i+1, rec.Name, tag, strings.Join(g.recipeStock(active, rec.Inputs), ", "), g.craftCost(rec))
+    }
+    fmt.Println("E) Experimenter un melange")
+    fmt.Println("U) Ameliorer un objet")
+    fmt.Println("0) Retour")
+    fmt.Print("Choix: ")
+    input := read(reader)
+    if g.consumeMenuReturn() {
+        return
+    }
+    if strings.EqualFold(input, "e") {
+        g.experiment(reader, active)
+        return
+    }
+    if strings.EqualFold(input, "u") {
+        g.upgradeMenu(reader, active)
+        return
+    }
+    choice, err := strconv.Atoi(input)
+    if err != nil || choice <= 0 || choice > len(list) {
+        fmt.Println("Aucun craft.")
+        return
+    }
+    g.forge(active, list[choice-1], true)
+}
+
+// Fabrique une recette si le niveau, l'or et les ingredients le permettent
+func (g *Game) forge(c *Character, rec RecipeDefinition, useStash bool) bool {
+    if rec.Skill > g.craftLevel() {
+        fmt.Printf("Spartan: \"Trop complexe pour toi. Reviens au niveau de forge %d.\"\n", rec.Skill)
+        return false
+    }
+    cost := g.craftCost(rec)
+    if g.Gold < cost {
+        fmt.Println("Or insuffisant.")
+        return false
+    }
+    if !g.hasIngredients(c, rec.Inputs, useStash) {
+        fmt.Println("Il vous manque des materiaux.")
+        return false
+    }
+    out := g.rollInstance(rec.OutputID, 1)
+    if !g.canReceive(c, out) {
+        fmt.Println("Sacoche et coffre pleins: faites de la place avant de forger.")
+        return false
+    }
+    if useStash {
+        g.takeIngredients(c, rec.Inputs)
+    } else {
+        c.removeItems(rec.Inputs)
+    }
+    g.Gold -= cost
+    for _, st := range out {
+        fmt.Printf("Vous forgez %s.\n", stackLabel(st))
+        g.deliver(c, st)
+    }
+    g.Crafted[rec.OutputID]++
+    g.gainCraftXP(2)
+    g.checkAchievements()
+    return true
+}
+
+// Mode libre: combine 2 ou 3 objets de la sacoche pour trouver des recettes
+func (g *Game) experiment(reader *bufio.Reader, c *Character) {
+    if len(c.Inventory) == 0 {
+        fmt.Println("Votre sacoche est vide.")
+        return
+    }
+    fmt.Println("\n-- Experimentation --")
+    for i, st := range c.Inventory {
+        fmt.Printf("%d) %s\n", i+1, stackLabel(st))
+    }
+    fmt.Print("Numeros de 2 ou 3 objets (ex: 1 3 3): ")
+    fields := strings.Fields(read(reader))
+    if g.consumeMenuReturn() {
+        return
+    }
+    if len(fields) < 2 || len(fields) > 3 {
+        fmt.Println("Il faut melanger 2 ou 3 objets.")
+        return
+    }
+    picked := []string{}
+    used := map[int]int{}
+    for _, f := range fields {
+        n, err := strconv.Atoi(f)
+        if err != nil || n <= 0 || n > len(c.Inventory) {
+            fmt.Println("Selection invalide.")
+            return
+        }
+        used[n-1]++
+        if used[n-1] > c.Inventory[n-1].Qty {
+            fmt.Printf("Vous n'avez pas assez de %s.\n", items[c.Inventory[n-1].ID].Name)
+            return
+        }
+        picked = append(picked, c.Inventory[n-1].ID)
+    }
+    fmt.Printf("Vous melangez: %s\n", strings.Join(recipeInputs(picked), " + "))
+    key := comboKey(picked)
+    for _, rec := range g.recipes {
+        if comboKey(rec.Inputs) != key {
+            continue
+        }
+        if !g.forge(c, rec, false) {
+            return
+        }
+        if rec.Hidden && !g.KnownRecipes[rec.ID] {
+            g.KnownRecipes[rec.ID] = true
+            fmt.Printf("Recette decouverte: %s ! Elle rejoint votre carnet.\n", rec.Name)
+            g.gainCraftXP(5)
+        }
+        return
+    }
+    fmt.Println(g.craftHint(picked))
+}
+
+// Indice apres un melange rate, selon la recette la plus proche
+func (g *Game) craftHint(picked []string) string {
+    best, shared := RecipeDefinition{}, 0
+    for _, rec := range g.recipes {
+        left := append([]string{}, rec.Inputs...)
+        n := 0
+        for _, id := range picked {
+            for i, in := range left {
+                if in == id {
+                    left = append(left[:i], left[i+1:]...)
+                    n++
+                    break
+                }
+            }
+        }
+        if n > shared {
+            best, shared = rec, n
+        }
+    }
+    switch {
+    case shared == 0:
+        return "Le melange fume et retombe en poussiere. Ces objets ne vont pas ensemble."
+    case shared == len(picked) && len(best.Inputs) > len(picked):
+        return "Ca fremit... il manque encore un ingredient."
+    case best.Hint != "":
+        return "Presque ! Spartan murmure: \"" + best.Hint + "\""
+    default:
+        return "Une partie du melange reagit, mais pas le reste."
+    }
+}
+
+// Valeur d'un bonus apres amelioration (+20% par niveau, au moins +1 par niveau)
+func upgraded(value, level int) int {
+    if value <= 0 || level <= 0 {
+        return value
+    }
+    return value + max(value*level/5, level)
+}
+
+// Renforce une etape d'effet selon le niveau de l'objet
+func upgradeStep(step EffectStep, level int) EffectStep {
+    switch step.Kind {
+    case effHeal, effMana, effDamage:
+        step.Amount = upgraded(step.Amount, level)
+        step.Bonus = upgraded(step.Bonus, level)
+    case effStatus:
+        if step.Status == statusPoison {
+            step.Amount = upgraded(step.Amount, level)
+        }
+    }
+    return step
+}
+
+// Indique si un effet de l'objet profite des ameliorations
+func hasScalableEffect(def ItemDefinition) bool {
+    for _, step := range def.Effects {
+        switch {
+        case step.Kind == effHeal, step.Kind == effMana, step.Kind == effDamage:
+            return true
+        case step.Kind == effStatus && step.Status == statusPoison:
+            return true
+        }
+    }
+    return false
+}
+
+// Bonus reels d'une piece d'equipement (description pour les autres objets)
+func gearBonusLabel(st ItemStack) string {
+    def := items[st.ID]
+    parts := []string{}
+    if def.MaxHPBonus > 0 {
+        parts = append(parts, fmt.Sprintf("+%d HP max", upgraded(def.MaxHPBonus, st.Upgrade)))
+    }
+    if def.MaxManaBonus > 0 {
+        parts = append(parts, fmt.Sprintf("+%d MP max", upgraded(def.MaxManaBonus, st.Upgrade)))
+    }
+    for _, a := range st.Affixes {
+        parts = append(parts, a.describe())
+    }
+    if len(parts) == 0 {
+        return def.Description
+    }
+    return strings.Join(parts, ", ")
+}
+
+// Cout d'une amelioration vers le niveau donne: materiaux, or, risque d'echec (%) et protection
+func upgradeCost(level int) (mats, gold, risk, protect int) {
+    return level, 6 * level, 10 * level, 5 * level
+}
+
+// Amelioration d'un disque ou d'une piece (sacoche ou portee) de +1 a +5
+func (g *Game) upgradeMenu(reader *bufio.Reader, c *Character) {
+    type entry struct {
+        idx  int
+        slot string
+        st   ItemStack
+    }
+    list := []entry{}
+    for i, st := range c.Inventory {
+        if items[st.ID].UpgradeWith != "" && st.Upgrade < maxUpgrade {
+            list = append(list, entry{idx: i, st: st})
+        }
+    }
+    for _, slot := range equipSlots {
+        if st, ok := c.Equipment[slot]; ok && items[st.ID].UpgradeWith != "" && st.Upgrade < maxUpgrade {
+            list = append(list, entry{idx: -1, slot: slot, st: st})
+        }
+    }
+    if len(list) == 0 {
+        fmt.Println("Rien a ameliorer pour l'instant.")
+        return
+    }
+    fmt.Println("\n-- Amelioration --")
+    for i, e := range list {
+        where := "sacoche"
+        if e.slot != "" {
+            where = "porte"
+        }
+        mats, gold, risk, _ := upgradeCost(e.st.Upgrade + 1)
+        fmt.Printf("%d) %s (%s) -> +%d : %dx %s, %d or, echec %d%%\n", i+1, stackLabel(e.st), where, e.st.Upgrade+1, mats, items[items[e.st.ID].UpgradeWith].Name, gold, risk)
+    }
+    fmt.Print("Choix (0 annuler): ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() || err != nil || choice <= 0 || choice > len(list) {
+        return
+    }
+    e := list[choice-1]
+    def := items[e.st.ID]
+    next := e.st.Upgrade + 1
+    mats, gold, risk, protect := upgradeCost(next)
+    needed := make([]string, mats)
+    for i := range needed {
+        needed[i] = def.UpgradeWith
+    }
+    if g.Gold < gold {
+        fmt.Println("Or insuffisant.")
+        return
+    }
+    if c.Inventory.count(def.UpgradeWith)+g.Stash.count(def.UpgradeWith) < mats {
+        fmt.Println("Il vous manque des materiaux.")
+        return
+    }
+    var piece ItemStack
+    if e.slot == "" {
+        piece = c.Inventory.takeAt(e.idx)
+        better := piece
+        better.Upgrade = next
+        if !c.Inventory.fits(better, c.InventoryMax) {
+            c.Inventory.put(piece)
+            fmt.Println("Votre sacoche est pleine: faites de la place avant d'ameliorer.")
+            return
+        }
+    } else {
+        piece = c.Equipment[e.slot]
+    }
+    if c.BetPts >= protect {
+        fmt.Printf("Proteger contre l'echec pour %d points de mise ? (o/n): ", protect)
+        answer := strings.ToLower(read(reader))
+        if g.consumeMenuReturn() {
+            if e.slot == "" {
+                c.Inventory.put(piece)
+            }
+            return
+        }
+        if answer == "o" {
+            c.BetPts -= protect
+            risk = 0
+        }
+    }
+    g.takeIngredients(c, needed)
+    g.Gold -= gold
+    if g.rng.Intn(100) < risk {
+        if e.slot == "" {
+            c.Inventory.put(piece)
+        }
+        fmt.Printf("Echec ! Spartan grimace: %s reste a +%d, les materiaux sont perdus.\n", def.Name, piece.Upgrade)
+        return
+    }
+    piece.Upgrade = next
+    if e.slot == "" {
+        c.Inventory.put(piece)
+    } else {
+        oldHP, oldMana := c.MaxHP, c.MaxMana
+        c.Equipment[e.slot] = piece
+        c.refreshStats()
+        c.HP += c.MaxHP - oldHP
+        c.Mana += c.MaxMana - oldMana
+    }
+    fmt.Printf("Reussite : %s !\n", stackLabel(piece))
+    g.gainCraftXP(1)
+}
+
+// Verifie que la sacoche (et le coffre si demande) contient tous les ingredients
+func (g *Game) hasIngredients(c *Character, ids []string, useStash bool) bool {
+    needed := map[string]int{}
+    for _, id := range ids {
+        needed[id]++
+    }
+    for id, qty := range needed {
+        have := c.Inventory.count(id)
+        if useStash {
+            have += g.Stash.count(id)
+        }
+        if have < qty {
+            return false
+        }
+    }
+    return true
+}
+
+// Retire des ingredients de la sacoche du personnage puis du coffre d'equipe
+func (g *Game) takeIngredients(c *Character, ids []string) bool {
+    needed := map[string]int{}
+    for _, id := range ids {
+        needed[id]++
+    }
+    for id, qty := range needed {
+        if c.Inventory.count(id)+g.Stash.count(id) < qty {
+            return false
+        }
+    }
+    for id, qty := range needed {
+        own := min(c.Inventory.count(id), qty)
+        c.Inventory.remove(id, own)
+        g.Stash.remove(id, qty-own)
+    }
+    return true
+}
+
+// Indique si chaque pile trouve sa place dans la sacoche ou le coffre
+func (g *Game) canReceive(c *Character, stacks []ItemStack) bool {
+    bag, stash := slices.Clone(c.Inventory), slices.Clone(g.Stash)
+    for _, st := range stacks {
+        switch {
+        case bag.fits(st, c.InventoryMax):
+            bag.put(st)
+        case stash.fits(st, stashMax):
+            stash.put(st)
+        default:
+            return false
+        }
+    }
+    return true
+}
+
+// Donne un objet au personnage, ou le range au coffre si sa sacoche est pleine
+func (g *Game) deliver(c *Character, st ItemStack) bool {
+    if c.Inventory.fits(st, c.InventoryMax) {
+        c.Inventory.put(st)
+        return true
+    }
+    if g.Stash.fits(st, stashMax) {
+        g.Stash.put(st)
+        fmt.Printf("Sacoche pleine: %s part au coffre d'equipe.\n", stackLabel(st))
+        return true
+    }
+    fmt.Printf("Sacoche et coffre pleins: %s est perdu.\n", stackLabel(st))
+    return false
+}
+
+// Pose une question a choix multiples au joueur
+func (g *Game) dialogueChoice(reader *bufio.Reader, prompt string, options []string) (int, bool) {
+    for {
+        fmt.Println(prompt)
+        for i, opt := range options {
+            fmt.Printf("%d) %s\n", i+1, opt)
+        }
+        fmt.Print("Reponse: ")
+        input := read(reader)
+        if g.consumeMenuReturn() {
+            return 0, true
+        }
+        choice, err := strconv.Atoi(input)
+        if err == nil && choice >= 1 && choice <= len(options) {
+            return choice - 1, false
+        }
+        fmt.Println("Choix invalide.")
+    }
+}
+
+// Scene d'introduction et tutoriel
+func (g *Game) prologue(reader *bufio.Reader) {
+    banner("Chapitre 0 - Cassette volee")
+    block(reader,
         "Crypton Future Media - 04h02. Les serveurs clignotent en rouge.",
         "La cassette legendaire a ete siphonnee par le label Pouler.fr.",
         "Sans elle, le chant de Miku disparaitra dans le bruit de la pub.",
     )
-    fmt.Println("Manager: \"Miku, Berger et Bagland verrouillent deja tous les flux.\"")
-    fmt.Println("Miku: \"Alors on va leur rappeler d'ou vient la vraie musique.\"")
+    fmt.Println("Manager: \"Miku, Berger et Bagland verrouillent deja tous les flux.\"")
+    fmt.Println("Miku: \"Alors on va leur rappeler d'ou vient la vraie musique.\"")
+    block(reader,
+        "Un hater streame en direct votre chute annoncee.",
+        "Montre que la scene n'appartient pas aux trolls.",
+    )
+    if g.consumeMenuReturn() {
+        return
+    }
+    enemy := Enemy{Name: "Hater de studio", Type: enemyHater, MaxHP: 28, HP: 28, Attack: 4, CritTimer: 3, Style: "Troll"}
+    g.fightSolo(reader, enemy, battleOptions{
+        Intro:       []string{"Hater: \"Pouler.fr gere maintenant la musique legitime !\""},
+        Victory:     []string{"Le live est coupe. Tes fans fideles se rassemblent."},
+        RewardXP:    20,
+        RewardGold:  6,
+    })
+    if g.consumeMenuReturn() {
+        return
+    }
+    block(reader,
+        "Luka: \"Quatre rivales gardent la cassette: Luka, Rin, Len et KAITO.\"",
+        "Kaito: \"Cherche des allies, gagne des fans, prepare tes disques.\"",
+        "Choisis tes destinations dans l'ordre que tu veux, sauf le Palais presidentiel qui attend une equipe complete.",
+    )
+    if g.consumeMenuReturn() {
+        return
+    }
+    g.StoryStage = stageArtists
+    g.autoSave()
+}
+
+// Renforcement des ennemis et des recompenses par cycle de New Game+
+const (
+    ngPlusEnemyScale  = 0.35
+    ngPlusRewardScale = 0.2
+)
+
+// Drapeaux d'histoire remis a zero a chaque New Game+
+var storyFlags = []string{"mj_recrute", "kaaris_recrute", "macron_recrute", "cassette_recuperee", "producteur_vaincu", "ironman_recorded", "quiz_rate", "pitch_nft", "pitch_goodies", "aff_mj_dialogue", "aff_mj_nft", "aff_mj_rythme", "aff_kaaris_dialogue", "aff_kaaris_goodies", "aff_macron_quiz", "aff_macron_quiz_rate"}
+
+// Multiplicateur lie au cycle de New Game+ en cours
+func (g *Game) cycleFactor(step float64) float64 {
+    return 1 + step*float64(g.Cycle)
+}
+
+// Propose de relancer l'histoire en New Game+ une fois la cassette recuperee
+func (g *Game) newGamePlus(reader *bufio.Reader) {
+    fmt.Println("L'histoire principale est terminee.")
+    next := g.Cycle + 1
+    fmt.Printf("New Game+ %d: l'histoire recommence avec vos niveaux, equipements, sorts et recettes, face a des ennemis renforces (+%d%%).\n", next, int(math.Round(ngPlusEnemyScale*100*float64(next))))
+    fmt.Printf("1) Lancer le New Game+ %d\n", next)
+    if g.Cycle > 0 {
+        fmt.Println("2) Studio abandonne (???)")
+    }
+    fmt.Println("0) Continuer a jouer librement")
+    fmt.Print("Choix: ")
+    choice := read(reader)
+    if g.consumeMenuReturn() {
+        return
+    }
+    if choice == "2" && g.Cycle > 0 {
+        g.phantomStudio(reader)
+        return
+    }
+    if choice != "1" {
+        return
+    }
+    g.Cycle = next
+    g.StoryStage = stagePrologue
+    g.ZoneStatus = map[string]ZoneStatus{
+        zoneMichael: {Unlocked: true},
+        zoneKaaris:  {Unlocked: true},
+        zoneMacron:  {Unlocked: false},
+    }
+    for _, flag := range storyFlags {
+        delete(g.Flags, flag)
+    }
+    for _, q := range quests {
+        if q.Main {
+            delete(g.Flags, "quete:"+q.ID)
+            delete(g.Flags, "quete_finie:"+q.ID)
+        }
+    }
+    for _, ch := range g.Characters {
+        ch.HP = ch.MaxHP
+        ch.Mana = ch.MaxMana
+    }
+    banner(fmt.Sprintf("New Game+ %d", g.Cycle))
+    fmt.Println("La bande rembobine. Le label a rachete le passe, mais vous, vous vous souvenez.")
+    g.autoSave()
+    g.prologue(reader)
+}
+
+// Boss secret du New Game+, cache dans un studio abandonne
+func (g *Game) phantomStudio(reader *bufio.Reader) {
+    if g.Flags["producteur_vaincu"] {
+        fmt.Println("Le studio abandonne est silencieux. Le fantome a rendu son dernier mix.")
+        return
+    }
+    banner("Studio abandonne")
+    block(reader,
+        "Une console analogique s'allume toute seule.",
+        "Une silhouette en smoking traverse la vitre de la cabine.",
+        "Producteur fantome: \"Chaque boucle du label passe par ma console. Voyons si ta cassette tient le tempo.\"",
+    )
+    if g.consumeMenuReturn() {
+        return
+    }
+    boss := []Enemy{{Name: "Producteur fantome", Type: enemyBoss, MaxHP: 240, HP: 240, Attack: 17, CritTimer: 2, Style: "Mastering"}}
+    if g.fightParty(reader, g.party(), boss, battleOptions{
+        Intro:      []string{"Les VU-metres s'affolent, la piece sature de reverb."},
+        Victory:    []string{"Producteur fantome: \"Enfin un mix que je ne peux pas racheter...\" Il se dissout dans le souffle de la bande."},
+        Defeat:     []string{"Le fantome rembobine la session: \"On refait une prise ?\""},
+        RewardXP:   150,
+        RewardGold: 30,
+        IsBoss:     true,
+        Reinforcements: []reinforcementWave{
+            {Round: 3, Call: "Le fantome pousse les faders: des echos prennent forme.", Enemies: []Enemy{
+                {Name: "Echo du studio", Type: enemyCrew, MaxHP: 40, HP: 40, Attack: 9, CritTimer: 3, Style: "Reverb"},
+                {Name: "Echo du studio", Type: enemyCrew, MaxHP: 40, HP: 40, Attack: 9, CritTimer: 3, Style: "Reverb"},
+            }, RewardXP: 10, RewardGold: 3},
+        },
+        MaxOnField: 3,
+    }) {
+        g.storyBeat("producteur_vaincu")
+        g.unlockAchievement("producteur_fantome")
+        g.autoSave()
+    }
+}
+
+// Hub permettant de selectionner la prochaine zone
+func (g *Game) artistHub(reader *bufio.Reader) {
+    for {
+        banner("Carte du monde sonore")
+        allies := []string{}
+        for _, ch := range g.Characters {
+            if ch.Name == "Hatsune Miku" {
+                continue
+            }
+            if ch.Unlocked {
+                allies = append(allies, ch.Name)
+            }
+        }
+        if len(allies) == 0 {
+            fmt.Println("Allies recrutes: aucun pour le moment.")
+        } else {
+            fmt.Println("Allies recrutes: " + strings.Join(allies, ", "))
+        }
+        fmt.Printf("Or: %d | Points de mise: %d\n", g.Gold, g.active().BetPts)
+        fmt.Printf("1) Neonopolis Pop (Michael Jackson) [%s]\n", zoneLabel(g.ZoneStatus[zoneMichael]))
+        fmt.Printf("2) Banlieue Rugueuse (Kaaris) [%s]\n", zoneLabel(g.ZoneStatus[zoneKaaris]))
+        if g.ZoneStatus[zoneMacron].Unlocked {
+            fmt.Printf("3) Palais presidentiel (Macron) [%s]\n", zoneLabel(g.ZoneStatus[zoneMacron]))
+        } else {
+            fmt.Println("3) Palais presidentiel (Macron) [acces refuse]")
+        }
+        fmt.Println("4) Coach vocal (redistribuer les competences)")
+        if g.Cycle > 0 {
+            fmt.Println("5) Studio abandonne (???)")
+        }
+        fmt.Println("0) Retour")
+        fmt.Print("Choix: ")
+        choice := read(reader)
+        if g.consumeMenuReturn() {
+            return
+        }
+        switch choice {
+        case "1":
+            if g.ZoneStatus[zoneMichael].Completed {
+                fmt.Println("MJ: \"Je suis deja avec toi. On garde le groove.\"")
+            } else {
+                g.zoneMichael(reader)
+            }
+        case "2":
+            if g.ZoneStatus[zoneKaaris].Completed {
+                fmt.Println("Kaaris: \"On est ensemble. File reprendre la cassette.\"")
+            } else {
+                g.zoneKaaris(reader)
+            }
+        case "3":
+            if !g.ZoneStatus[zoneMacron].Unlocked {
+                fmt.Println("Un agent: \"Le president attend une equipe complete, pas une idole seule.\"")
+            } else if g.ZoneStatus[zoneMacron].Completed {
+                fmt.Println("Macron: \"Direction le label, la Republique te regarde.\"")
+            } else {
+                fmt.Println("Le Palais est pret a te recevoir via l'histoire principale.")
+            }
+        case "4":
+            g.respecMenu(reader)
+        case "5":
+            if g.Cycle == 0 {
+                fmt.Println("Choix invalide.")
+                break
+            }
+            g.phantomStudio(reader)
+        case "0":
+            return
+        default:
+            fmt.Println("Choix invalide.")
+        }
+        if g.ZoneStatus[zoneMichael].Completed && g.ZoneStatus[zoneKaaris].Completed && !g.ZoneStatus[zoneMacron].Unlocked {
+            fmt.Println("Un message crypte: \"Le Palais t'ouvre ses portes.\"")
+            g.ZoneStatus[zoneMacron] = ZoneStatus{Unlocked: true}
+            g.StoryStage = stageMacron
+            g.autoSave()
+            return
+        }
+    }
+}
+
+// Mini-jeu de rythme pour convaincre MJ
+func (g *Game) playRhythmChallenge(reader *bufio.Reader) bool {
+    patterns := [][]string{
+        {"MI", "KU", "MI", "KU"},
+        {"POP", "ROCK", "POP"},
+        {"UP", "LEFT", "RIGHT", "UP"},
+        {"BEAT", "REST", "BEAT"},
+        {"LA", "MI", "SO", "LA"},
+    }
+    seq := patterns[g.rng.Intn(len(patterns))]
+    fmt.Println("MJ: \"Observe les syllabes puis renvoie-les sans erreur.\"")
+    for i, syl := range seq {
+        fmt.Printf("Beat %d -> %s\n", i+1, syl)
+        time.Sleep(350 * time.Millisecond)
+    }
+    fmt.Println("Inscris la sequence sans espace (ex: POPROCKPOP):")
+    raw := read(reader)
+    if activeGame != nil && activeGame.consumeMenuReturn() {
+        return false
+    }
+    input := strings.ToUpper(strings.ReplaceAll(raw, " ", ""))
+    target := strings.ToUpper(strings.Join(seq, ""))
+    if input == target {
+        fmt.Println("MJ: \"Tu as le groove.\"")
+        return true
+    }
+    fmt.Println("MJ: \"Tempo decale. Reviens quand tu seras calee.\"")
+    return false
+}
+
+// Quete de recrutement de Michael Jackson
+func (g *Game) zoneMichael(reader *bufio.Reader) {
+    banner("Neonopolis Pop")
+    block(reader,
+        "La ville brille dans un rose synthwave.",
+        "Michael Jackson glisse d'un hologramme et te fixe.",
+        "MJ: \"Tu veux sauver la musique ? Montre que tu respectes le tempo.\"",
+    )
+    if g.Cycle > 0 {
+        fmt.Println("MJ: \"Attends... ce refrain, je l'ai deja danse avec toi. Le label a rembobine le monde, pas nos souvenirs.\"")
+    }
+    choice, abort := g.dialogueChoice(reader, "Comment repondre a MJ ?", []string{"La pop respire quand on mixe futur et nostalgie.", "Je peux t'offrir un NFT unique."})
+    if abort {
+        return
+    }
+    if choice == 1 {
+        fmt.Println("MJ: \"La musique n'est pas un produit derive. Reviens quand tu ecoutes vraiment.\"")
+        g.Flags["pitch_nft"] = true
+        g.dialogueAffinity("aff_mj_nft", g.Characters[3], -10)
+        return
+    }
+    g.dialogueAffinity("aff_mj_dialogue", g.Characters[3], 10)
+    if !g.playRhythmChallenge(reader) {
+        return
+    }
+    g.dialogueAffinity("aff_mj_rythme", g.Characters[3], 5)
+    block(reader,
+        "Les bots marketing du label saturent la place.",
+        "MJ: \"On nettoie la scene.\"",
+    )
+    enemy := Enemy{Name: "Bot viral", Type: enemyHater, MaxHP: 60, HP: 60, Attack: 7, CritTimer: 3, Style: "Pop toxique"}
+    g.fightSolo(reader, enemy, battleOptions{
+        Region:     regionNeonopolis,
+        Intro:      []string{"Les bots hurlent un refrain generique."},
+        Victory:    []string{"Les hologrammes repassent un clip libre."},
+        RewardXP:   35,
+        RewardGold: 7,
+    })
+    if g.consumeMenuReturn() {
+        return
+    }
+    if !g.Characters[3].Unlocked {
+        g.Characters[3].Unlocked = true
+        g.Characters[3].HP = g.Characters[3].MaxHP
+        g.Characters[3].Mana = g.Characters[3].MaxMana
+        fmt.Println("Michael Jackson rejoint votre equipe !")
+    }
+    if g.active().addItem("equip_glove") {
+        fmt.Println("Vous recevez le Gant legendaire.")
+    }
+    g.ZoneStatus[zoneMichael] = ZoneStatus{Unlocked: true, Completed: true}
+    g.storyBeat("mj_recrute")
+    g.autoSave()
+}
+
+// Quete de recrutement de Kaaris
+func (g *Game) zoneKaaris(reader *bufio.Reader) {
+    banner("Banlieue Rugueuse")
+    block(reader,
+        "Les tours vibrent sur un kick sale.",
+        "Kaaris attend, capuche en place, micro a la main.",
+        "Kaaris: \"Ici on respecte le travail.\"",
+    )
+    if g.Cycle > 0 {
+        fmt.Println("Kaaris: \"Ta tete me dit quelque chose. Si on s'est deja affrontes, cette fois je frappe plus fort.\"")
+    }
+    choice, abort := g.dialogueChoice(reader, "Comment t'approches-tu ?", []string{"Je viens apprendre de ta scene.", "Je veux vendre des goodies."})
+    if abort {
+        return
+    }
+    if choice == 0 {
+        fmt.Println("Kaaris hoche la tete, un demi-sourire sous la capuche.")
+        g.dialogueAffinity("aff_kaaris_dialogue", g.Characters[1], 10)
+    } else {
+        fmt.Println("Kaaris: \"Les goodies, c'est pour les touristes.\"")
+        g.Flags["pitch_goodies"] = true
+        g.dialogueAffinity("aff_kaaris_goodies", g.Characters[1], -10)
+    }
+    block(reader,
+        "Des haineux testent ta solidite avant le duel.",
+    )
+    if g.consumeMenuReturn() {
+        return
+    }
+    g.fightParty(reader, []*Character{g.active()}, []Enemy{{Name: "Haineux de quartier", Type: enemyCrew, MaxHP: 55, HP: 55, Attack: 6, CritTimer: 3, Style: "Rue"}}, battleOptions{
+        Region:       regionBanlieue,
+        AllowBet:     true,
+        Intro:        []string{"Le beat tombe a 90 BPM, les coudes aussi."},
+        Victory:      []string{"Le crew de reserve se retire."},
+        RewardXP:     35,
+        RewardGold:   6,
+        RewardBetPts: 1,
+        Reinforcements: []reinforcementWave{
+            {Round: 3, Call: "Le haineux siffle entre ses doigts: son crew descend du hall.", Enemies: []Enemy{
+                {Name: "Guetteur du hall", Type: enemyCrew, MaxHP: 22, HP: 22, Attack: 4, CritTimer: 3, Style: "Rue"},
+                {Name: "Guetteur du parking", Type: enemyCrew, MaxHP: 22, HP: 22, Attack: 4, CritTimer: 3, Style: "Rue"},
+            }, RewardXP: 8, RewardGold: 2},
+        },
+        MaxOnField: 2,
+    })
+    if g.consumeMenuReturn() {
+        return
+    }
+    block(reader,
+        "Kaaris pose le micro entre vous.",
+        "Kaaris: \"Maintenant c'est moi que tu dois convaincre.\"",
+    )
+    duel := Enemy{Name: "Duel avec Kaaris", Type: enemyCrew, MaxHP: 80, HP: 80, Attack: 8, CritTimer: 3, Style: "Drill"}
+    if g.fightSolo(reader, duel, battleOptions{
+        Region:     regionBanlieue,
+        Intro:      []string{"Le crew entoure le ring improvise."},
+        Victory:    []string{"Kaaris: \"Respect. J'entre dans ton equipe.\""},
+        Defeat:     []string{"Kaaris: \"Reviens avec plus de coffre.\""},
+        RewardXP:   45,
+        RewardGold: 8,
+    }) {
+        if g.active() == g.Characters[0] {
+            g.unlockAchievement("miku_vs_kaaris")
+        }
+        if !g.Characters[1].Unlocked {
+            g.Characters[1].Unlocked = true
+            g.Characters[1].HP = g.Characters[1].MaxHP
+            g.Characters[1].Mana = g.Characters[1].MaxMana
+            fmt.Println("Kaaris rejoint votre equipe !")
+        }
+        if g.active().addItem("crew_totem") {
+            fmt.Println("Vous obtenez le Pouvoir d'invocation du crew.")
+        }
+        if !g.CraftUnlocked {
+            fmt.Println("Un ingenieur du son Spartan ouvre son atelier: le craft est desormais disponible.")
+            g.CraftUnlocked = true
+        }
+        g.ZoneStatus[zoneKaaris] = ZoneStatus{Unlocked: true, Completed: true}
+        g.storyBeat("kaaris_recrute")
+        g.autoSave()
+    }
+    if g.consumeMenuReturn() {
+        return
+    }
+}
+
+// Quete de recrutement d'Emmanuel Macron
+func (g *Game) macronMission(reader *bufio.Reader) {
+    status := g.ZoneStatus[zoneMacron]
+    if !status.Unlocked {
+        fmt.Println("Le Palais reste ferme pour le moment.")
+        return
+    }
+    if status.Completed {
+        fmt.Println("Macron: \"Cap sur le label, la Republique te soutient.\"")
+        g.StoryStage = stageLabel
+        return
+    }
+    banner("Palais presidentiel")
+    block(reader,
+        "Le palais ressemble a un plateau TV: marbre, drapeaux, cameras.",
+        "Emmanuel Macron ajuste son micro-cravate.",
+        "Macron: \"Montre-moi que tu connais la culture que tu defends.\"",
+    )
+    quiz := []struct{
+        q string
+        a string
+    }{
+        {"Annee du debut de la Revolution francaise ?", "1789"},
+        {"Devise inscrite sur les frontons francais ?", "liberte egalite fraternite"},
+        {"Compositeur de la Marseillaise ?", "rouget de lisle"},
+    }
+    for _, qa := range quiz {
+        fmt.Println(qa.q)
+        fmt.Print("Reponse: ")
+        raw := read(reader)
+        if g.consumeMenuReturn() {
+            return
+        }
+        ans := strings.ToLower(strings.ReplaceAll(raw, "e", "e"))
+        ans = strings.ReplaceAll(ans, "'", "")
+        if ans != qa.a {
+            fmt.Println("Macron: \"Reviens avec plus de fond.\"")
+            g.Flags["quiz_rate"] = true
+            g.dialogueAffinity("aff_macron_quiz_rate", g.Characters[2], -3)
+            return
+        }
+        fmt.Println("Macron hoche la tete.")
+    }
+    g.dialogueAffinity("aff_macron_quiz", g.Characters[2], 15)
+    block(reader,
+        "La division strategique du label tente de couper l'entretien.",
+        "Macron: \"Je reste a tes cotes.\"",
+    )
+    g.fightSolo(reader, Enemy{Name: "Division strategique", Type: enemyCrew, MaxHP: 100, HP: 100, Attack: 11, CritTimer: 3, Style: "Lobby"}, battleOptions{
+        Region:     regionPalais,
+        Intro:      []string{"Les conseillers du label projectent des slides marketing."},
+        Victory:    []string{"Macron brandit un badge d'acces dore."},
+        RewardXP:   55,
+        RewardGold: 12,
+    })
+    if g.consumeMenuReturn() {
+        return
+    }
+    if !g.Characters[2].Unlocked {
+        g.Characters[2].Unlocked = true
+        g.Characters[2].HP = g.Characters[2].MaxHP
+        g.Characters[2].Mana = g.Characters[2].MaxMana
+        fmt.Println("Macron rejoint votre equipe en tant que stratege.")
+    }
+    if g.active().addItem("pass_label") {
+        fmt.Println("Vous recevez le Pass presidentiel. Le QG peut maintenant s'ouvrir.")
+    }
+    g.ZoneStatus[zoneMacron] = ZoneStatus{Unlocked: true, Completed: true}
+    g.storyBeat("macron_recrute")
+    g.StoryStage = stageLabel
+    g.autoSave()
+}
+
+// Fin du scenario, choisie selon les choix et les performances du profil
+type ending struct {
+    ID    string
+    Name  string
+    Lines []string
+    When  func(g *Game, bossKO bool) bool
+}
+
+// Fins possibles, de la plus exigeante a la fin par defaut
+var endings = []ending{
+    {ID: "legende_libre", Name: "La legende libre", Lines: []string{
+        "Miku glisse la cassette dans le lecteur sous les yeux de ses trois allies.",
+        "Pas un contrat signe, pas une note vendue: la melodie repart telle qu'elle est nee.",
+        "Le monde entier chante, et pour la premiere fois personne ne touche de droits dessus.",
+    }, When: func(g *Game, bossKO bool) bool {
+        return !g.Flags["quiz_rate"] && !bossKO && !g.Flags["pitch_nft"] && !g.Flags["pitch_goodies"] && g.bondedAllies() >= 2
+    }},
+    {ID: "idole_sous_licence", Name: "Idole sous licence", Lines: []string{
+        "La cassette est liberee... et les goodies de Miku inondent deja les boutiques.",
+        "Berger sourit depuis sa cellule de crise: \"Vous voyez ? Tout finit en produit derive.\"",
+        "La musique est libre, mais son visage, lui, est sous licence.",
+    }, When: func(g *Game, bossKO bool) bool {
+        return g.Flags["pitch_nft"] || g.Flags["pitch_goodies"]
+    }},
+    {ID: "victoire_amere", Name: "Victoire amere", Lines: []string{
+        "Miku se releve a peine, la cassette fendue entre ses doigts.",
+        "Le signal repart, gresillant: le monde entend la musique libre, avec une cicatrice dans le son.",
+        "Miku: \"Elle n'est pas parfaite. Elle est a nous.\"",
+    }, When: func(g *Game, bossKO bool) bool {
+        return bossKO
+    }},
+    {ID: "bande_a_part", Name: "Bande a part", Lines: []string{
+        "Tes allies brisent les dernieres cages et te soulevent sur leurs epaules.",
+        "La cassette tourne, le quatuor improvise un concert sauvage sur le toit du label.",
+        "La vraie musique appartient a ceux qui la jouent ensemble.",
+    }, When: func(g *Game, bossKO bool) bool {
+        return g.bondedAllies() >= 2
+    }},
+    {ID: "grand_pari", Name: "Le grand pari", Lines: []string{
+        "Miku mise la cassette sur un dernier coup de des... et rafle la mise.",
+        "Elle rachete le label avec ses gains et le transforme en salle de concert gratuite.",
+        "Le bookmaker de Neonopolis n'a jamais vu une telle serie.",
+    }, When: func(g *Game, bossKO bool) bool {
+        return g.Bets.Won >= 15
+    }},
+    {ID: "cassette_retrouvee", Name: "La cassette retrouvee", Lines: []string{
+        "Miku remet la cassette dans son lecteur: le monde entier recoit a nouveau des melodies libres.",
+        "La vraie musique appartient aux artistes et au public, pas aux labels.",
+    }, When: func(g *Game, bossKO bool) bool {
+        return true
+    }},
+}
+
+// Nombre d'allies au palier d'affinite le plus fort
+func (g *Game) bondedAllies() int {
+    n := 0
+    for _, ch := range g.Characters {
+        if ch.Name != "Hatsune Miku" && ch.Affinity >= affinityBond {
+            n++
+        }
+    }
+    return n
+}
+
+// Choisit la premiere fin dont les conditions sont remplies
+func (g *Game) pickEnding(bossKO bool) ending {
+    for _, e := range endings {
+        if e.When(g, bossKO) {
+            return e
+        }
+    }
+    return endings[len(endings)-1]
+}
+
+// Galerie des fins deja vues par le profil
+func (g *Game) endingGallery() {
+    banner("Galerie des fins")
+    fmt.Printf("Fins decouvertes: %d/%d\n", len(g.Endings), len(endings))
+    for i, e := range endings {
+        if n := g.Endings[e.ID]; n > 0 {
+            fmt.Printf("%d) %s (vue %d fois)\n", i+1, e.Name, n)
+            fmt.Println("    " + e.Lines[len(e.Lines)-1])
+        } else {
+            fmt.Printf("%d) ???\n", i+1)
+        }
+    }
+}
+
+// Combat final contre le label Pouler.fr
+func (g *Game) labelFinal(reader *bufio.Reader) {
+    if !g.ZoneStatus[zoneMacron].Completed {
+        fmt.Println("Rassemble Macron avant de prendre d'assaut le label.")
+        return
+    }
+    party := g.party()
+    if len(party) < 4 {
+        fmt.Println("Forme d'abord ton quatuor legendaire.")
+        return
+    }
+    banner("Chapitre 4 - Label Pouler.fr")
     block(reader,
-        "Un hater streame en direct votre chute annoncee.",
-        "Montre que la scene n'appartient pas aux trolls.",
+        "Atrium du label: neon bleu, contrats encadres, foule captive.",
+        "Les quatre rivales de Miku se preparent a defendre leur monopole.",
     )
     if g.consumeMenuReturn() {
         return
     }
-    enemy := Enemy{Name: "Hater de studio", Type: enemyHater, MaxHP: 28, HP: 28, Attack: 4, CritTimer: 3, Style: "Troll"}
-    g.fightSolo(reader, enemy, battleOptions{
-        Intro:       []string{"Hater: \"Pouler.fr gere maintenant la musique legitime !\""},
-        Victory:     []string{"Le live est coupe. Tes fans fideles se rassemblent."},
-        RewardXP:    20,
-        RewardGold:  6,
-    })
+    waveOne := []Enemy{
+        {Name: "Megurine Luka", Type: enemyRival, MaxHP: 95, HP: 95, Attack: 11, CritTimer: 3, Style: "Pop aquatique"},
+        {Name: "Kagamine Rin", Type: enemyRival, MaxHP: 100, HP: 100, Attack: 12, CritTimer: 3, Style: "Electro rap"},
+    }
+    bossKO := false
+    if !g.fightParty(reader, party, waveOne, battleOptions{
+        Region:     regionQG,
+        Intro:      []string{"Luka lance une ballade hypnotique, Rin tranche avec des refrains rapides."},
+        Victory:    []string{"Rin: \"D'accord, Miku. Tu veux partager la scene... prouve-le.\""},
+        RewardXP:   60,
+        RewardGold: 15,
+    }) {
+        fmt.Println("Les rivales se moquent: \"Reviens avec plus de souffle.\"")
+        return
+    }
+    bossKO = bossKO || g.lastAllyKO
+    shortRest(party)
+    fmt.Println("La loge improvisee rend 10 HP et 5 MP a chaque allie.")
+    waveTwo := []Enemy{
+        {Name: "Kagamine Len", Type: enemyRival, MaxHP: 115, HP: 115, Attack: 13, CritTimer: 2, Style: "Rock urbain"},
+        {Name: "KAITO", Type: enemyRival, MaxHP: 125, HP: 125, Attack: 14, CritTimer: 3, Style: "Classique glace"},
+    }
+    if !g.fightParty(reader, party, waveTwo, battleOptions{
+        Region:     regionQG,
+        Intro:      []string{"Len sort une guitare electrique, KAITO dresse un mur symphonique."},
+        Victory:    []string{"KAITO: \"La scene n'appartient a personne. Gagne ton final.\""},
+        RewardXP:   70,
+        RewardGold: 18,
+    }) {
+        fmt.Println("Len: \"On vous attend pour une vraie bagarre.\"")
+        return
+    }
+    bossKO = bossKO || g.lastAllyKO
     block(reader,
-        "Luka: \"Quatre rivales gardent la cassette: Luka, Rin, Len et KAITO.\"",
-        "Kaito: \"Cherche des allies, gagne des fans, prepare tes disques.\"",
-        "Choisis tes destinations dans l'ordre que tu veux, sauf le Palais presidentiel qui attend une equipe complete.",
+        "Mattieu Berger et Sylvain Bagland applaudissent avec arrogance.",
+        "Ils declenchent des cages de verre autour de tes allies.",
+        "Miku se retrouve seule au centre de la scene.",
     )
+    if g.Cycle > 0 {
+        fmt.Println("Berger: \"Encore vous ? Nous avons rachete les droits de votre derniere victoire.\"")
+        fmt.Println("Miku: \"Les droits, peut-etre. Pas la chanson.\"")
+    }
+    solo := []*Character{g.Characters[0]}
+    g.Characters[0].resetCombatFlags()
+    bosses := []Enemy{
+        {Name: "Mattieu Berger", Type: enemyBoss, MaxHP: 165, HP: 165, Attack: 15, CritTimer: 3, Style: "Business"},
+        {Name: "Sylvain Bagland", Type: enemyBoss, MaxHP: 155, HP: 155, Attack: 15, CritTimer: 2, Style: "Business"},
+    }
+    if !g.fightParty(reader, solo, bosses, battleOptions{
+        Region: regionQG,
+        Intro: []string{"Berger: \"Sans ta cassette tu n'es rien.\"", "Bagland: \"La musique se monetise, point.\""},
+        Victory: []string{"La cassette legendaire scintille de nouveau entre les mains de Miku."},
+        Defeat:  []string{"Berger: \"Le marche decide. Reviens avec plus de fans.\""},
+        RewardXP:   120,
+        RewardGold: 25,
+        IsBoss:     true,
+        Reinforcements: []reinforcementWave{
+            {Round: 2, Call: "Berger claque des doigts: \"Maitre, on a une plaignante.\"", Enemies: []Enemy{
+                {Name: "Avocat du label", Type: enemyCrew, MaxHP: 45, HP: 45, Attack: 8, CritTimer: 3, Style: "Juridique"},
+            }, RewardXP: 15, RewardGold: 4},
+            {Round: 4, Call: "Bagland: \"Faites monter le service contentieux !\"", Enemies: []Enemy{
+                {Name: "Avocat du label", Type: enemyCrew, MaxHP: 45, HP: 45, Attack: 8, CritTimer: 3, Style: "Juridique"},
+                {Name: "Huissier du label", Type: enemyCrew, MaxHP: 40, HP: 40, Attack: 9, CritTimer: 2, Style: "Juridique"},
+            }, RewardXP: 15, RewardGold: 4},
+        },
+        MaxOnField: 3,
+    }) {
+        fmt.Println("Les dirigeants sourient: \"On te verra a la prochaine sortie.\"")
+        return
+    }
+    bossKO = bossKO || g.lastAllyKO
+    fmt.Println("Les cages explosent, tes allies te rejoignent.")
+    end := g.pickEnding(bossKO)
+    banner("Fin - " + end.Name)
+    block(reader, end.Lines...)
+    for _, ch := range g.Characters {
+        if line, ok := affinityEpilogues[ch.Name]; ok && ch.Affinity >= affinityBond {
+            fmt.Println(line)
+        }
+    }
+    if g.Cycle > 0 {
+        fmt.Println("Au loin, une console grince dans un studio abandonne: quelqu'un ecoute encore la bande.")
+    }
     if g.consumeMenuReturn() {
         return
     }
-    g.StoryStage = stageArtists
+    g.StoryStage = stageFinish
+    g.storyBeat("cassette_recuperee")
+    if g.Endings[end.ID] == 0 {
+        fmt.Println("Nouvelle fin ajoutee a la galerie !")
+    }
+    g.Endings[end.ID]++
+    g.updateQuests()
+    if !bossKO {
+        g.unlockAchievement("label_sans_ko")
+    }
+    if g.playTime() < speedrunLimit {
+        g.unlockAchievement("sortie_express")
+    }
+    if g.Ironman && !g.Flags["ironman_recorded"] && g.saver != nil {
+        if err := g.saver.recordHallOfFame(g.hallOfFameRecord("", true)); err == nil {
+            g.Flags["ironman_recorded"] = true
+            fmt.Println("Votre course ironman entre au hall of fame !")
+        }
+    }
     g.autoSave()
 }
+// Valeur d'attaque de base selon le personnage (bonus d'ensemble compris)
+func baseAttack(c *Character) int {
+    atk := 9
+    switch c.Name {
+    case "Kaaris":
+        atk = 12
+    case "Michael Jackson":
+        atk = 10
+    }
+    return atk + c.setBonus().Attack + c.skillBonus().Attack
+}
 
-// Hub permettant de selectionner la prochaine zone
-func (g *Game) artistHub(reader *bufio.Reader) {
-    for {
-        banner("Carte du monde sonore")
-        allies := []string{}
-        for _, ch := range g.Characters {
-            if ch.Name == "Hatsune Miku" {
-                continue
-            }
-            if ch.Unlocked {
-                allies = append(allies, ch.Name)
-            }
-        }
-        if len(allies) == 0 {
-            fmt.Println("Allies recrutes: aucun pour le moment.")
-        } else {
-            fmt.Println("Allies recrutes: " + strings.Join(allies, ", "))
+
+// Type de cible attendu par une action de combat
+type targetKind int
+
+const (
+    targetEnemy targetKind = iota
+    targetAllEnemies
+    targetRandomEnemies
+    targetAlly
+    targetAllAllies
+    targetSelf
+    targetKOAlly
+)
+
+// Cible declaree par une action (Count sert aux cibles aleatoires)
+type targetSpec struct {
+    Kind  targetKind
+    Count int
+}
+
+// Cibles resolues au moment de l'action
+type battleTargets struct {
+    Enemies []*Enemy
+    Allies  []*Character
+}
+
+func (t battleTargets) empty() bool {
+    return len(t.Enemies) == 0 && len(t.Allies) == 0
+}
+
+var (
+    attackTarget = targetSpec{Kind: targetEnemy}
+    noteTarget   = targetSpec{Kind: targetEnemy}
+    nyanTarget   = targetSpec{Kind: targetEnemy}
+)
+
+// Decrit une cible pour les menus
+func targetLabel(spec targetSpec) string {
+    switch spec.Kind {
+    case targetAllEnemies:
+        return "tous les ennemis"
+    case targetRandomEnemies:
+        return fmt.Sprintf("%d ennemis au hasard", spec.Count)
+    case targetAlly:
+        return "un allie"
+    case targetAllAllies:
+        return "toute l'equipe"
+    case targetSelf:
+        return "soi-meme"
+    case targetKOAlly:
+        return "un allie KO"
+    default:
+        return "un ennemi"
+    }
+}
+
+// Traduit une cible declaree en cibles concretes, en demandant au joueur si besoin
+func (g *Game) resolveTargets(reader *bufio.Reader, spec targetSpec, user *Character, party []*Character, enemies []Enemy) (battleTargets, bool) {
+    var out battleTargets
+    switch spec.Kind {
+    case targetEnemy:
+        if aliveEnemies(enemies) == 0 {
+            fmt.Println("Aucun adversaire a viser.")
+            return out, false
         }
-        fmt.Printf("Or: %d | Points de mise: %d\n", g.Gold, g.active().BetPts)
-        fmt.Printf("1) Neonopolis Pop (Michael Jackson) [%s]\n", zoneLabel(g.ZoneStatus[zoneMichael]))
-        fmt.Printf("2) Banlieue Rugueuse (Kaaris) [%s]\n", zoneLabel(g.ZoneStatus[zoneKaaris]))
-        if g.ZoneStatus[zoneMacron].Unlocked {
-            fmt.Printf("3) Palais presidentiel (Macron) [%s]\n", zoneLabel(g.ZoneStatus[zoneMacron]))
+        var target *Enemy
+        if aliveEnemies(enemies) == 1 {
+            target = &enemies[firstAliveEnemy(enemies)]
         } else {
-            fmt.Println("3) Palais presidentiel (Macron) [acces refuse]")
+            tgt, abort := selectEnemy(reader, enemies)
+            if abort {
+                return out, true
+            }
+            target = tgt
         }
-        fmt.Println("0) Retour")
-        fmt.Print("Choix: ")
-        choice := read(reader)
-        if g.consumeMenuReturn() {
-            return
+        if target != nil {
+            out.Enemies = []*Enemy{target}
         }
-        switch choice {
-        case "1":
-            if g.ZoneStatus[zoneMichael].Completed {
-                fmt.Println("MJ: \"Je suis deja avec toi. On garde le groove.\"")
-            } else {
-                g.zoneMichael(reader)
+    case targetAllEnemies:
+        for i := range enemies {
+            if enemies[i].HP > 0 {
+                out.Enemies = append(out.Enemies, &enemies[i])
             }
-        case "2":
-            if g.ZoneStatus[zoneKaaris].Completed {
-                fmt.Println("Kaaris: \"On est ensemble. File reprendre la cassette.\"")
-            } else {
-                g.zoneKaaris(reader)
+        }
+    case targetRandomEnemies:
+        alive := []*Enemy{}
+        for i := range enemies {
+            if enemies[i].HP > 0 {
+                alive = append(alive, &enemies[i])
             }
-        case "3":
-            if !g.ZoneStatus[zoneMacron].Unlocked {
-                fmt.Println("Un agent: \"Le president attend une equipe complete, pas une idole seule.\"")
-            } else if g.ZoneStatus[zoneMacron].Completed {
-                fmt.Println("Macron: \"Direction le label, la Republique te regarde.\"")
+        }
+        g.rng.Shuffle(len(alive), func(i, j int) { alive[i], alive[j] = alive[j], alive[i] })
+        count := spec.Count
+        if count <= 0 || count > len(alive) {
+            count = len(alive)
+        }
+        out.Enemies = alive[:count]
+    case targetAlly, targetKOAlly:
+        ally, abort := selectAlly(reader, party, spec.Kind == targetKOAlly)
+        if abort {
+            return out, true
+        }
+        if ally == nil {
+            if spec.Kind == targetKOAlly {
+                fmt.Println("Aucun allie KO a relever.")
             } else {
-                fmt.Println("Le Palais est pret a te recevoir via l'histoire principale.")
+                fmt.Println("Aucun allie en etat.")
             }
-        case "0":
-            return
-        default:
-            fmt.Println("Choix invalide.")
+            return out, false
         }
-        if g.ZoneStatus[zoneMichael].Completed && g.ZoneStatus[zoneKaaris].Completed && !g.ZoneStatus[zoneMacron].Unlocked {
-            fmt.Println("Un message crypte: \"Le Palais t'ouvre ses portes.\"")
-            g.ZoneStatus[zoneMacron] = ZoneStatus{Unlocked: true}
-            g.StoryStage = stageMacron
-            g.autoSave()
-            return
+        out.Allies = []*Character{ally}
+    case targetAllAllies:
+        for _, ally := range party {
+            if ally != nil && ally.HP > 0 {
+                out.Allies = append(out.Allies, ally)
+            }
         }
+    case targetSelf:
+        out.Allies = []*Character{user}
     }
+    return out, false
 }
 
-// Mini-jeu de rythme pour convaincre MJ
-func (g *Game) playRhythmChallenge(reader *bufio.Reader) bool {
-    patterns := [][]string{
-        {"MI", "KU", "MI", "KU"},
-        {"POP", "ROCK", "POP"},
-        {"UP", "LEFT", "RIGHT", "UP"},
-        {"BEAT", "REST", "BEAT"},
-        {"LA", "MI", "SO", "LA"},
+// Applique les bonus de combat du personnage a des degats bruts
+func boostDamage(c *Character, dmg, guardBonus int) int {
+    if c.BattleBoost > 0 {
+        dmg *= c.BattleBoost
     }
-    seq := patterns[g.rng.Intn(len(patterns))]
-    fmt.Println("MJ: \"Observe les syllabes puis renvoie-les sans erreur.\"")
-    for i, syl := range seq {
-        fmt.Printf("Beat %d -> %s\n", i+1, syl)
-        time.Sleep(350 * time.Millisecond)
+    if c.IgnoreGuard {
+        dmg += guardBonus
+        c.IgnoreGuard = false
     }
-    fmt.Println("Inscris la sequence sans espace (ex: POPROCKPOP):")
-    raw := read(reader)
-    if activeGame != nil && activeGame.consumeMenuReturn() {
-        return false
+    return dmg
+}
+
+// Inflige des degats a un ennemi sans descendre sous zero
+func hitEnemy(e *Enemy, dmg int) {
+    e.HP -= dmg
+    if e.HP < 0 {
+        e.HP = 0
     }
-    input := strings.ToUpper(strings.ReplaceAll(raw, " ", ""))
-    target := strings.ToUpper(strings.Join(seq, ""))
-    if input == target {
-        fmt.Println("MJ: \"Tu as le groove.\"")
-        return true
+}
+
+// Capacite speciale d'un personnage et la cible qu'elle attend
+type specialMove struct {
+    Name   string
+    Cost   int
+    Skill  string
+    Duo    string
+    Target targetSpec
+    Unlock func(c *Character) bool
+    Locked string
+    NoMana string
+    Run    func(g *Game, c *Character, t battleTargets) bool
+}
+
+// Phrase d'accroche affichee avant le choix d'une capacite
+var specialPrompts = map[string]string{
+    "Hatsune Miku":    "Miku: \"Quel refrain ?\"",
+    "Kaaris":          "Kaaris: \"On choisit quoi ?\"",
+    "Emmanuel Macron": "Macron: \"Quelle tactique ?\"",
+    "Michael Jackson": "MJ: \"Choisis ton groove.\"",
+}
+
+// Capacites speciales de chaque personnage
+var specials = map[string][]specialMove{
+    "Hatsune Miku": {
+        {
+            Name:   "Note explosive legendaire",
+            Cost:   15,
+            Target: targetSpec{Kind: targetEnemy},
+            Unlock: func(c *Character) bool { return c.HasNoteSpell },
+            Locked: "Miku n'a pas encore retrouve la note explosive.",
+            NoMana: "Pas assez de mana pour la note explosive legendaire.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                enemy := t.Enemies[0]
+                dmg := boostDamage(c, 30+g.rng.Intn(11)+c.skillBonus().NoteDamage, 8)
+                hitEnemy(enemy, dmg)
+                fmt.Printf("Miku declenche la note explosive legendaire sur %s (-%d HP).\n", enemy.Name, dmg)
+                return true
+            },
+        },
+        {
+            Name:   "Pluie arc-en-ciel",
+            Cost:   20,
+            Target: targetSpec{Kind: targetRandomEnemies, Count: 3},
+            Unlock: func(c *Character) bool { return c.Level >= 3 },
+            Locked: "Les Nyan Cats ne repondent a l'appel de Miku qu'a partir du niveau 3.",
+            NoMana: "Pas assez de mana pour faire pleuvoir les Nyan Cats.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                for _, enemy := range t.Enemies {
+                    dmg := boostDamage(c, 12+g.rng.Intn(6)+c.skillBonus().NyanDamage, 4)
+                    hitEnemy(enemy, dmg)
+                    fmt.Printf("Un Nyan Cat percute %s (-%d HP).\n", enemy.Name, dmg)
+                }
+                return true
+            },
+        },
+        {
+            Name:   "Note fracassante",
+            Cost:   22,
+            Skill:  "miku_note_3",
+            Target: targetSpec{Kind: targetEnemy},
+            NoMana: "Pas assez de mana pour la note fracassante.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                enemy := t.Enemies[0]
+                dmg := boostDamage(c, 40+g.rng.Intn(11)+c.skillBonus().NoteDamage, 8)
+                hitEnemy(enemy, dmg)
+                enemy.WeakenTurns = max(enemy.WeakenTurns, 2)
+                fmt.Printf("La note fracassante sonne %s (-%d HP) : il est affaibli 2 tours.\n", enemy.Name, dmg)
+                return true
+            },
+        },
+        {
+            Name:   "Nyan nova",
+            Cost:   26,
+            Skill:  "miku_nyan_3",
+            Target: targetSpec{Kind: targetAllEnemies},
+            NoMana: "Pas assez de mana pour la Nyan nova.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                for _, enemy := range t.Enemies {
+                    dmg := boostDamage(c, 18+g.rng.Intn(7)+c.skillBonus().NyanDamage, 5)
+                    hitEnemy(enemy, dmg)
+                    fmt.Printf("L'explosion arc-en-ciel balaie %s (-%d HP).\n", enemy.Name, dmg)
+                }
+                return true
+            },
+        },
+    },
+    "Kaaris": {
+        {
+            Name:   "Crew devastateur",
+            Target: targetSpec{Kind: targetEnemy},
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                enemy := t.Enemies[0]
+                dmg := boostDamage(c, 34+g.rng.Intn(13), 10)
+                hitEnemy(enemy, dmg)
+                fmt.Printf("Kaaris invoque son crew sur %s (-%d HP).\n", enemy.Name, dmg)
+                return true
+            },
+        },
+        {
+            Name:   "Bouclier de rue",
+            Cost:   10,
+            Target: targetSpec{Kind: targetAlly},
+            NoMana: "Pas assez de mana pour lever le bouclier.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                ally := t.Allies[0]
+                shield := 24 + c.skillBonus().ShieldBonus
+                ally.ShieldHP += shield
+                fmt.Printf("Un bouclier d'acier entoure %s (+%d HP absorbables).\n", ally.Name, shield)
+                return true
+            },
+        },
+        {
+            Name:   "Mur du crew",
+            Cost:   18,
+            Target: targetSpec{Kind: targetAllAllies},
+            NoMana: "Pas assez de mana pour proteger tout le monde.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                shield := 18 + c.skillBonus().ShieldBonus
+                for _, ally := range t.Allies {
+                    ally.ShieldHP += shield
+                }
+                if len(t.Allies) == 1 {
+                    fmt.Printf("Le crew forme un bouclier autour de toi (+%d HP absorbables).\n", shield)
+                } else {
+                    fmt.Printf("Le crew erige un mur protecteur pour l'equipe (+%d HP absorbables chacun).\n", shield)
+                }
+                return true
+            },
+        },
+        {
+            Name:   "Descente du crew",
+            Cost:   22,
+            Target: targetSpec{Kind: targetAllEnemies},
+            NoMana: "Pas assez de mana pour rameuter tout le quartier.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                for _, enemy := range t.Enemies {
+                    dmg := boostDamage(c, 14+g.rng.Intn(7), 5)
+                    hitEnemy(enemy, dmg)
+                    fmt.Printf("Le crew deferle sur %s (-%d HP).\n", enemy.Name, dmg)
+                }
+                return true
+            },
+        },
+        {
+            Name:   "Appel du quartier",
+            Cost:   20,
+            Skill:  "kaaris_crew_3",
+            Target: targetSpec{Kind: targetRandomEnemies, Count: 3},
+            NoMana: "Pas assez de mana pour appeler le quartier.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                for _, enemy := range t.Enemies {
+                    dmg := boostDamage(c, 22+g.rng.Intn(9), 6)
+                    hitEnemy(enemy, dmg)
+                    fmt.Printf("Tout le quartier tombe sur %s (-%d HP).\n", enemy.Name, dmg)
+                }
+                return true
+            },
+        },
+        {
+            Name:   "Rempart",
+            Cost:   20,
+            Skill:  "kaaris_shield_3",
+            Target: targetSpec{Kind: targetAllAllies},
+            NoMana: "Pas assez de mana pour dresser le rempart.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                shield := 30 + c.skillBonus().ShieldBonus
+                for _, ally := range t.Allies {
+                    ally.ShieldHP += shield
+                }
+                c.DodgeNext = true
+                fmt.Printf("Kaaris dresse un rempart (+%d HP absorbables chacun) et guette le prochain coup.\n", shield)
+                return true
+            },
+        },
+        {
+            Name:   "Duo Drill x Nyan",
+            Cost:   18,
+            Duo:    "Hatsune Miku",
+            Target: targetSpec{Kind: targetEnemy},
+            NoMana: "Pas assez de mana pour lancer le duo.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                enemy := t.Enemies[0]
+                dmg := boostDamage(c, 38+g.rng.Intn(11), 8)
+                hitEnemy(enemy, dmg)
+                enemy.WeakenTurns = max(enemy.WeakenTurns, 1)
+                fmt.Printf("Kaaris fait la courte echelle a Miku: un Nyan Cat plonge sur %s (-%d HP).\n", enemy.Name, dmg)
+                return true
+            },
+        },
+    },
+    "Emmanuel Macron": {
+        {
+            Name:   "Discours manipulateur",
+            Cost:   12,
+            Target: targetSpec{Kind: targetEnemy},
+            NoMana: "Pas assez d'energie pour le discours manipulateur.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                enemy := t.Enemies[0]
+                if enemy.WeakenTurns < 2 {
+                    enemy.WeakenTurns = 2
+                }
+                fmt.Printf("Macron deboussole %s : ses degats sont divises pendant 2 tours.\n", enemy.Name)
+                return true
+            },
+        },
+        {
+            Name:   "Interdiction de chanter",
+            Cost:   14,
+            Target: targetSpec{Kind: targetEnemy},
+            NoMana: "Pas assez d'energie pour l'interdiction de chanter.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                enemy := t.Enemies[0]
+                enemy.SilenceTurns = 1
+                fmt.Printf("%s recoit une interdiction de chanter et ne pourra pas attaquer ce tour-ci.\n", enemy.Name)
+                return false
+            },
+        },
+        {
+            Name:   "49.3",
+            Cost:   20,
+            Skill:  "macron_speech_3",
+            Target: targetSpec{Kind: targetAllEnemies},
+            NoMana: "Pas assez d'energie pour passer en force.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                for _, enemy := range t.Enemies {
+                    enemy.SilenceTurns = max(enemy.SilenceTurns, 1)
+                }
+                fmt.Println("Macron degaine le 49.3 : aucun ennemi ne pourra attaquer ce tour-ci.")
+                return false
+            },
+        },
+        {
+            Name:   "En meme temps",
+            Cost:   18,
+            Skill:  "macron_reform_3",
+            Target: targetSpec{Kind: targetEnemy},
+            NoMana: "Pas assez d'energie pour faire les deux a la fois.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                enemy := t.Enemies[0]
+                dmg := boostDamage(c, 24+g.rng.Intn(7), 6)
+                hitEnemy(enemy, dmg)
+                enemy.WeakenTurns = max(enemy.WeakenTurns, 2)
+                fmt.Printf("Macron frappe et negocie en meme temps : %s perd %d HP et s'affaiblit.\n", enemy.Name, dmg)
+                return true
+            },
+        },
+        {
+            Name:   "Meeting en duo",
+            Cost:   18,
+            Duo:    "Hatsune Miku",
+            Target: targetSpec{Kind: targetAllAllies},
+            NoMana: "Pas assez de mana pour tenir le meeting.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                for _, ally := range t.Allies {
+                    if ally.HP <= 0 {
+                        continue
+                    }
+                    ally.HP = min(ally.MaxHP, ally.HP+20)
+                    if ally.Name == "Hatsune Miku" {
+                        ally.Mana = min(ally.MaxMana, ally.Mana+10)
+                    }
+                }
+                fmt.Println("Macron chauffe la salle, Miku reprend le refrain: toute l'equipe recupere 20 HP, Miku 10 MP.")
+                return true
+            },
+        },
+    },
+    "Michael Jackson": {
+        {
+            Name:   "Moonwalk offensif",
+            Cost:   8,
+            Target: targetSpec{Kind: targetEnemy},
+            NoMana: "Pas assez d'energie pour le moonwalk.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                enemy := t.Enemies[0]
+                dmg := boostDamage(c, 20+g.rng.Intn(9), 6)
+                hitEnemy(enemy, dmg)
+                c.DodgeNext = true
+                fmt.Printf("MJ glisse en moonwalk et inflige %d degats a %s. Il esquivera le prochain coup.\n", dmg, enemy.Name)
+                return true
+            },
+        },
+        {
+            Name:   "Beat therapy",
+            Cost:   12,
+            Target: targetSpec{Kind: targetSelf},
+            NoMana: "Pas assez d'energie pour ce solo.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                heal := 32 + c.skillBonus().HealBonus
+                c.HP += heal
+                if c.HP > c.MaxHP {
+                    c.HP = c.MaxHP
+                }
+                fmt.Printf("MJ improvise un solo apaisant et se soigne (+%d HP).\n", heal)
+                return true
+            },
+        },
+        {
+            Name:   "Harmonie partagee",
+            Cost:   18,
+            Target: targetSpec{Kind: targetAllAllies},
+            NoMana: "Pas assez d'energie pour harmoniser l'equipe.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                heal := 20 + c.skillBonus().HealBonus
+                for _, ally := range t.Allies {
+                    ally.HP += heal
+                    if ally.HP > ally.MaxHP {
+                        ally.HP = ally.MaxHP
+                    }
+                }
+                fmt.Printf("Le choeur de MJ guerit l'equipe (+%d HP chacun).\n", heal)
+                return true
+            },
+        },
+        {
+            Name:   "Thriller",
+            Cost:   20,
+            Skill:  "mj_moon_3",
+            Target: targetSpec{Kind: targetAllEnemies},
+            NoMana: "Pas assez d'energie pour Thriller.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                for _, enemy := range t.Enemies {
+                    dmg := boostDamage(c, 16+g.rng.Intn(7), 5)
+                    hitEnemy(enemy, dmg)
+                    fmt.Printf("Les zombies de Thriller encerclent %s (-%d HP).\n", enemy.Name, dmg)
+                }
+                c.DodgeNext = true
+                return true
+            },
+        },
+        {
+            Name:   "Heal the World",
+            Cost:   24,
+            Skill:  "mj_choir_3",
+            Target: targetSpec{Kind: targetAllAllies},
+            NoMana: "Pas assez d'energie pour sauver le monde.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                heal := 35 + c.skillBonus().HealBonus
+                for _, ally := range t.Allies {
+                    ally.HP = min(ally.HP+heal, ally.MaxHP)
+                    ally.Mana = min(ally.Mana+5, ally.MaxMana)
+                }
+                fmt.Printf("MJ entonne Heal the World (+%d HP et +5 MP chacun).\n", heal)
+                return true
+            },
+        },
+        {
+            Name:   "Moonwalk a deux",
+            Cost:   16,
+            Duo:    "Hatsune Miku",
+            Target: targetSpec{Kind: targetAllEnemies},
+            NoMana: "Pas assez de mana pour le moonwalk a deux.",
+            Run: func(g *Game, c *Character, t battleTargets) bool {
+                for _, enemy := range t.Enemies {
+                    dmg := boostDamage(c, 16+g.rng.Intn(6), 4)
+                    hitEnemy(enemy, dmg)
+                    fmt.Printf("MJ et Miku glissent a travers %s (-%d HP).\n", enemy.Name, dmg)
+                }
+                c.DodgeNext = true
+                return true
+            },
+        },
+    },
+}
+
+// Noeud d'arbre de competences; Requires designe le noeud precedent de la branche
+type skillNode struct {
+    ID          string
+    Branch      string
+    Name        string
+    Description string
+    Cost        int
+    Requires    string
+    Bonus       skillBonus
+}
+
+// Effets cumules des competences acquises
+type skillBonus struct {
+    MaxHP           int
+    MaxMana         int
+    Attack          int
+    NoteDamage      int
+    NoteDiscount    int
+    NyanDamage      int
+    NyanDiscount    int
+    SpecialDiscount int
+    ShieldBonus     int
+    HealBonus       int
+}
+
+// Arbres de competences par personnage (deux branches chacun)
+var skillTrees = map[string][]skillNode{
+    "Hatsune Miku": {
+        {ID: "miku_note_1", Branch: "Note", Name: "Souffle tenu", Description: "Note explosive +6 degats", Cost: 1, Bonus: skillBonus{NoteDamage: 6}},
+        {ID: "miku_note_2", Branch: "Note", Name: "Crescendo", Description: "Note explosive -3 MP, +8 MP max", Cost: 1, Requires: "miku_note_1", Bonus: skillBonus{NoteDiscount: 3, MaxMana: 8}},
+        {ID: "miku_note_3", Branch: "Note", Name: "Note fracassante", Description: "Debloque la capacite Note fracassante", Cost: 2, Requires: "miku_note_2"},
+        {ID: "miku_nyan_1", Branch: "Nyan Cat", Name: "Nyan turbo", Description: "Attaque Nyan Cat +6 degats", Cost: 1, Bonus: skillBonus{NyanDamage: 6}},
+        {ID: "miku_nyan_2", Branch: "Nyan Cat", Name: "Croquettes arc-en-ciel", Description: "Attaque Nyan Cat -4 MP", Cost: 1, Requires: "miku_nyan_1", Bonus: skillBonus{NyanDiscount: 4}},
+        {ID: "miku_nyan_3", Branch: "Nyan Cat", Name: "Nyan nova", Description: "Debloque la capacite Nyan nova", Cost: 2, Requires: "miku_nyan_2"},
+    },
+    "Kaaris": {
+        {ID: "kaaris_crew_1", Branch: "Crew", Name: "Crew soude", Description: "+2 attaque", Cost: 1, Bonus: skillBonus{Attack: 2}},
+        {ID: "kaaris_crew_2", Branch: "Crew", Name: "Tournee des blocs", Description: "Capacites -4 MP", Cost: 1, Requires: "kaaris_crew_1", Bonus: skillBonus{SpecialDiscount: 4}},
+        {ID: "kaaris_crew_3", Branch: "Crew", Name: "Appel du quartier", Description: "Debloque la capacite Appel du quartier", Cost: 2, Requires: "kaaris_crew_2"},
+        {ID: "kaaris_shield_1", Branch: "Bouclier", Name: "Acier trempe", Description: "Boucliers +8", Cost: 1, Bonus: skillBonus{ShieldBonus: 8}},
+        {ID: "kaaris_shield_2", Branch: "Bouclier", Name: "Carrure", Description: "+20 HP max", Cost: 1, Requires: "kaaris_shield_1", Bonus: skillBonus{MaxHP: 20}},
+        {ID: "kaaris_shield_3", Branch: "Bouclier", Name: "Rempart", Description: "Debloque la capacite Rempart", Cost: 2, Requires: "kaaris_shield_2"},
+    },
+    "Emmanuel Macron": {
+        {ID: "macron_speech_1", Branch: "Rhetorique", Name: "Elements de langage", Description: "Capacites -3 MP", Cost: 1, Bonus: skillBonus{SpecialDiscount: 3}},
+        {ID: "macron_speech_2", Branch: "Rhetorique", Name: "Grand debat", Description: "+10 MP max", Cost: 1, Requires: "macron_speech_1", Bonus: skillBonus{MaxMana: 10}},
+        {ID: "macron_speech_3", Branch: "Rhetorique", Name: "49.3", Description: "Debloque la capacite 49.3", Cost: 2, Requires: "macron_speech_2"},
+        {ID: "macron_reform_1", Branch: "Reforme", Name: "Start-up nation", Description: "+2 attaque", Cost: 1, Bonus: skillBonus{Attack: 2}},
+        {ID: "macron_reform_2", Branch: "Reforme", Name: "Protocole", Description: "+15 HP max", Cost: 1, Requires: "macron_reform_1", Bonus: skillBonus{MaxHP: 15}},
+        {ID: "macron_reform_3", Branch: "Reforme", Name: "En meme temps", Description: "Debloque la capacite En meme temps", Cost: 2, Requires: "macron_reform_2"},
+    },
+    "Michael Jackson": {
+        {ID: "mj_moon_1", Branch: "Moonwalk", Name: "Pas glisse", Description: "+2 attaque", Cost: 1, Bonus: skillBonus{Attack: 2}},
+        {ID: "mj_moon_2", Branch: "Moonwalk", Name: "Chapeau lance", Description: "Capacites -3 MP", Cost: 1, Requires: "mj_moon_1", Bonus: skillBonus{SpecialDiscount: 3}},
+        {ID: "mj_moon_3", Branch: "Moonwalk", Name: "Thriller", Description: "Debloque la capacite Thriller", Cost: 2, Requires: "mj_moon_2"},
+        {ID: "mj_choir_1", Branch: "Choeur", Name: "Voix de tete", Description: "Soins +10", Cost: 1, Bonus: skillBonus{HealBonus: 10}},
+        {ID: "mj_choir_2", Branch: "Choeur", Name: "Souffle long", Description: "+10 MP max", Cost: 1, Requires: "mj_choir_1", Bonus: skillBonus{MaxMana: 10}},
+        {ID: "mj_choir_3", Branch: "Choeur", Name: "Heal the World", Description: "Debloque la capacite Heal the World", Cost: 2, Requires: "mj_choir_2"},
+    },
+}
+
+// Cumule les bonus des competences acquises
+func (c *Character) skillBonus() skillBonus {
+    var total skillBonus
+    for _, node := range skillTrees[c.Name] {
+        if !c.Skills[node.ID] {
+            continue
+        }
+        b := node.Bonus
+        total.MaxHP += b.MaxHP
+        total.MaxMana += b.MaxMana
+        total.Attack += b.Attack
+        total.NoteDamage += b.NoteDamage
+        total.NoteDiscount += b.NoteDiscount
+        total.NyanDamage += b.NyanDamage
+        total.NyanDiscount += b.NyanDiscount
+        total.SpecialDiscount += b.SpecialDiscount
+        total.ShieldBonus += b.ShieldBonus
+        total.HealBonus += b.HealBonus
+    }
+    return total
+}
+
+// Points depenses dans l'arbre
+func (c *Character) skillsSpent() int {
+    spent := 0
+    for _, node := range skillTrees[c.Name] {
+        if c.Skills[node.ID] {
+            spent += node.Cost
+        }
+    }
+    return spent
+}
+
+// Cout en mana de l'attaque Nyan Cat apres competences
+func (c *Character) nyanCost() int {
+    return max(16-c.skillBonus().NyanDiscount, 0)
+}
+
+// Affiche l'arbre et laisse depenser les points de competence
+func (g *Game) skillMenu(reader *bufio.Reader, c *Character) {
+    tree := skillTrees[c.Name]
+    if len(tree) == 0 {
+        fmt.Println("Aucun arbre de competences pour ce personnage.")
+        return
+    }
+    for {
+        fmt.Printf("\n=== Competences de %s (%d point(s)) ===\n", c.Name, c.SkillPoints)
+        branch := ""
+        for i, node := range tree {
+            if node.Branch != branch {
+                branch = node.Branch
+                fmt.Printf("-- %s --\n", branch)
+            }
+            mark := "[ ]"
+            switch {
+            case c.Skills[node.ID]:
+                mark = "[x]"
+            case node.Requires != "" && !c.Skills[node.Requires]:
+                mark = "[-]"
+            }
+            fmt.Printf("%d) %s %s (%d pt) - %s\n", i+1, mark, node.Name, node.Cost, node.Description)
+        }
+        fmt.Print("Competence a apprendre (0 retour): ")
+        choice, err := strconv.Atoi(read(reader))
+        if g.consumeMenuReturn() || err != nil || choice <= 0 || choice > len(tree) {
+            return
+        }
+        node := tree[choice-1]
+        switch {
+        case c.Skills[node.ID]:
+            fmt.Println("Deja acquise.")
+        case node.Requires != "" && !c.Skills[node.Requires]:
+            fmt.Println("Apprenez d'abord la competence precedente de la branche.")
+        case c.SkillPoints < node.Cost:
+            fmt.Println("Points de competence insuffisants.")
+        default:
+            c.SkillPoints -= node.Cost
+            c.Skills[node.ID] = true
+            c.refreshStats()
+            fmt.Printf("%s apprend %s.\n", c.Name, node.Name)
+        }
     }
-    fmt.Println("MJ: \"Tempo decale. Reviens quand tu seras calee.\"")
-    return false
 }
 
-// Quete de recrutement de Michael Jackson
-func (g *Game) zoneMichael(reader *bufio.Reader) {
-    banner("Neonopolis Pop")
-    block(reader,
-        "La ville brille dans un rose synthwave.",
-        "Michael Jackson glisse d'un hologramme et te fixe.",
-        "MJ: \"Tu veux sauver la musique ? Montre que tu respectes le tempo.\"",
-    )
-    choice, abort := g.dialogueChoice(reader, "Comment repondre a MJ ?", []string{"La pop respire quand on mixe futur et nostalgie.", "Je peux t'offrir un NFT unique."})
-    if abort {
-        return
+// Prix d'une redistribution: 15 or par point engage (competences et traits)
+func respecPrice(c *Character) int {
+    return 15 * (c.skillsSpent() + c.traitsSpent())
+}
+
+// Coach vocal du hub: rend les points de competence contre de l'or
+func (g *Game) respecMenu(reader *bufio.Reader) {
+    party := g.party()
+    fmt.Println("\n=== Coach vocal ===")
+    for i, ch := range party {
+        fmt.Printf("%d) %s - %d point(s) engage(s), %d or\n", i+1, ch.Name, ch.skillsSpent()+ch.traitsSpent(), respecPrice(ch))
     }
-    if choice == 1 {
-        fmt.Println("MJ: \"La musique n'est pas un produit derive. Reviens quand tu ecoutes vraiment.\"")
+    fmt.Print("Qui redistribue (0 annuler): ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() || err != nil || choice <= 0 || choice > len(party) {
         return
     }
-    if !g.playRhythmChallenge(reader) {
+    ch := party[choice-1]
+    spent, price := ch.skillsSpent()+ch.traitsSpent(), respecPrice(ch)
+    if spent == 0 {
+        fmt.Println("Rien a redistribuer.")
         return
     }
-    block(reader,
-        "Les bots marketing du label saturent la place.",
-        "MJ: \"On nettoie la scene.\"",
-    )
-    enemy := Enemy{Name: "Bot viral", Type: enemyHater, MaxHP: 60, HP: 60, Attack: 7, CritTimer: 3, Style: "Pop toxique"}
-    g.fightSolo(reader, enemy, battleOptions{
-        Intro:      []string{"Les bots hurlent un refrain generique."},
-        Victory:    []string{"Les hologrammes repassent un clip libre."},
-        RewardXP:   35,
-        RewardGold: 7,
-    })
-    if g.consumeMenuReturn() {
+    if g.Gold < price {
+        fmt.Println("Or insuffisant.")
         return
     }
-    if !g.Characters[3].Unlocked {
-        g.Characters[3].Unlocked = true
-        g.Characters[3].HP = g.Characters[3].MaxHP
-        g.Characters[3].Mana = g.Characters[3].MaxMana
-        fmt.Println("Michael Jackson rejoint votre equipe !")
+    g.Gold -= price
+    ch.Skills = map[string]bool{}
+    ch.Traits = map[string]int{}
+    ch.SkillPoints += spent
+    ch.refreshStats()
+    fmt.Printf("%s recupere %d point(s) de competence.\n", ch.Name, spent)
+}
+
+// Points de trait achetes en plus du rang de base (1+2+... par amelioration)
+func (c *Character) traitsSpent() int {
+    spent := 0
+    for _, up := range c.Traits {
+        spent += up * (up + 1) / 2
     }
-    if g.active().addItem("equip_glove") {
-        fmt.Println("Vous recevez le Gant legendaire.")
+    return spent
+}
+
+// Declencheurs des traits passifs
+const (
+    traitManaRegen = "mana_tour"
+    traitHPRegen   = "soin_tour"
+    traitReflect   = "renvoi"
+    traitGuard     = "encaisse"
+    traitDodge     = "esquive"
+    traitGold      = "or_victoire"
+    traitXP        = "xp_victoire"
+    traitDiscount  = "remise"
+)
+
+// Trait passif: actif des MinLevel, Values donne l'effet de chaque rang
+type trait struct {
+    ID          string
+    Name        string
+    Hook        string
+    Description string
+    MinLevel    int
+    Values      []int
+}
+
+// Traits passifs de chaque personnage
+var traits = map[string][]trait{
+    "Hatsune Miku": {
+        {ID: "miku_souffle", Name: "Souffle de scene", Hook: traitManaRegen, Description: "+%d MP a chaque fin de tour", MinLevel: 1, Values: []int{2, 4, 6}},
+        {ID: "miku_star", Name: "Star montante", Hook: traitXP, Description: "+%d%% d'XP apres une victoire", MinLevel: 5, Values: []int{10, 20, 30}},
+    },
+    "Kaaris": {
+        {ID: "kaaris_renvoi", Name: "Retour a l'envoyeur", Hook: traitReflect, Description: "renvoie %d%% des degats au corps a corps", MinLevel: 1, Values: []int{20, 30, 40}},
+        {ID: "kaaris_peau", Name: "Peau dure", Hook: traitGuard, Description: "-%d degats par coup recu", MinLevel: 5, Values: []int{1, 2, 3}},
+    },
+    "Emmanuel Macron": {
+        {ID: "macron_fonds", Name: "Levee de fonds", Hook: traitGold, Description: "+%d%% d'or apres une victoire", MinLevel: 1, Values: []int{15, 25, 35}},
+        {ID: "macron_carnet", Name: "Carnet d'adresses", Hook: traitDiscount, Description: "-%d%% chez le disquaire tant qu'il est dans l'equipe", MinLevel: 5, Values: []int{3, 6, 10}},
+    },
+    "Michael Jackson": {
+        {ID: "mj_velours", Name: "Pas de velours", Hook: traitDodge, Description: "%d%% de chances d'esquiver un coup", MinLevel: 1, Values: []int{10, 15, 20}},
+        {ID: "mj_encore", Name: "Encore !", Hook: traitHPRegen, Description: "+%d HP a chaque fin de tour", MinLevel: 5, Values: []int{2, 3, 4}},
+    },
+}
+
+// Styles d'attaque a distance, que Retour a l'envoyeur ne peut pas renvoyer
+var rangedStyles = map[string]bool{"Reverb": true, "Mastering": true, "Juridique": true, "Lobby": true, "Loop": true}
+
+// Rang actuel d'un trait (0 tant que le niveau requis n'est pas atteint)
+func (c *Character) traitRank(t trait) int {
+    if c.Level < t.MinLevel {
+        return 0
     }
-    g.ZoneStatus[zoneMichael] = ZoneStatus{Unlocked: true, Completed: true}
-    g.autoSave()
+    return min(1+c.Traits[t.ID], len(t.Values))
 }
 
-// Quete de recrutement de Kaaris
-func (g *Game) zoneKaaris(reader *bufio.Reader) {
-    banner("Banlieue Rugueuse")
-    block(reader,
-        "Les tours vibrent sur un kick sale.",
-        "Kaaris attend, capuche en place, micro a la main.",
-        "Kaaris: \"Ici on respecte le travail.\"",
-    )
-    if _, abort := g.dialogueChoice(reader, "Comment t'approches-tu ?", []string{"Je viens apprendre de ta scene.", "Je veux vendre des goodies."}); abort {
-        return
+// Effet cumule des traits actifs pour un declencheur
+func (c *Character) traitValue(hook string) int {
+    total := 0
+    for _, t := range traits[c.Name] {
+        if rank := c.traitRank(t); rank > 0 && t.Hook == hook {
+            total += t.Values[rank-1]
+        }
     }
-    block(reader,
-        "Des haineux testent ta solidite avant le duel.",
-    )
-    if g.consumeMenuReturn() {
+    return total
+}
+
+// Libelle d'un trait avec son rang et son effet
+func (c *Character) traitLabel(t trait) string {
+    rank := c.traitRank(t)
+    if rank == 0 {
+        return fmt.Sprintf("%s (verrouille, niveau %d) - %s", t.Name, t.MinLevel, fmt.Sprintf(t.Description, t.Values[0]))
+    }
+    return fmt.Sprintf("%s (rang %d/%d) - %s", t.Name, rank, len(t.Values), fmt.Sprintf(t.Description, t.Values[rank-1]))
+}
+
+// Affiche les traits passifs du personnage
+func (c *Character) printTraits() {
+    if len(traits[c.Name]) == 0 {
         return
     }
-    g.fightSolo(reader, Enemy{Name: "Haineux de quartier", Type: enemyCrew, MaxHP: 55, HP: 55, Attack: 6, CritTimer: 3, Style: "Rue"}, battleOptions{
-        AllowBet:     true,
-        Intro:        []string{"Le beat tombe a 90 BPM, les coudes aussi."},
-        Victory:      []string{"Le crew de reserve se retire."},
-        RewardXP:     35,
-        RewardGold:   6,
-        RewardBetPts: 1,
-    })
-    if g.consumeMenuReturn() {
+    fmt.Println("-- Traits --")
+    for _, t := range traits[c.Name] {
+        fmt.Println(c.traitLabel(t))
+    }
+}
+
+// Ameliore les traits debloques contre des points de competence
+func (g *Game) traitMenu(reader *bufio.Reader, c *Character) {
+    list := traits[c.Name]
+    if len(list) == 0 {
+        fmt.Println("Aucun trait pour ce personnage.")
         return
     }
-    block(reader,
-        "Kaaris pose le micro entre vous.",
-        "Kaaris: \"Maintenant c'est moi que tu dois convaincre.\"",
-    )
-    duel := Enemy{Name: "Duel avec Kaaris", Type: enemyCrew, MaxHP: 80, HP: 80, Attack: 8, CritTimer: 3, Style: "Drill"}
-    if g.fightSolo(reader, duel, battleOptions{
-        Intro:      []string{"Le crew entoure le ring improvise."},
-        Victory:    []string{"Kaaris: \"Respect. J'entre dans ton equipe.\""},
-        Defeat:     []string{"Kaaris: \"Reviens avec plus de coffre.\""},
-        RewardXP:   45,
-        RewardGold: 8,
-    }) {
-        if !g.Characters[1].Unlocked {
-            g.Characters[1].Unlocked = true
-            g.Characters[1].HP = g.Characters[1].MaxHP
-            g.Characters[1].Mana = g.Characters[1].MaxMana
-            fmt.Println("Kaaris rejoint votre equipe !")
+    for {
+        fmt.Printf("\n=== Traits de %s (%d point(s)) ===\n", c.Name, c.SkillPoints)
+        for i, t := range list {
+            cost := ""
+            if rank := c.traitRank(t); rank > 0 && rank < len(t.Values) {
+                cost = fmt.Sprintf(" [rang suivant: %d pt]", rank)
+            }
+            fmt.Printf("%d) %s%s\n", i+1, c.traitLabel(t), cost)
         }
-        if g.active().addItem("crew_totem") {
-            fmt.Println("Vous obtenez le Pouvoir d'invocation du crew.")
+        fmt.Print("Trait a ameliorer (0 retour): ")
+        choice, err := strconv.Atoi(read(reader))
+        if g.consumeMenuReturn() || err != nil || choice <= 0 || choice > len(list) {
+            return
         }
-        if !g.CraftUnlocked {
-            fmt.Println("Un ingenieur du son Spartan ouvre son atelier: le craft est desormais disponible.")
-            g.CraftUnlocked = true
+        t := list[choice-1]
+        rank := c.traitRank(t)
+        switch {
+        case rank == 0:
+            fmt.Printf("Ce trait se debloque au niveau %d.\n", t.MinLevel)
+        case rank >= len(t.Values):
+            fmt.Println("Rang maximal deja atteint.")
+        case c.SkillPoints < rank:
+            fmt.Println("Points de competence insuffisants.")
+        default:
+            c.SkillPoints -= rank
+            c.Traits[t.ID]++
+            fmt.Printf("%s passe au rang %d: %s.\n", t.Name, rank+1, fmt.Sprintf(t.Description, t.Values[rank]))
         }
-        g.ZoneStatus[zoneKaaris] = ZoneStatus{Unlocked: true, Completed: true}
-        g.autoSave()
-    }
-    if g.consumeMenuReturn() {
-        return
     }
 }
 
-// Quete de recrutement d'Emmanuel Macron
-func (g *Game) macronMission(reader *bufio.Reader) {
-    status := g.ZoneStatus[zoneMacron]
-    if !status.Unlocked {
-        fmt.Println("Le Palais reste ferme pour le moment.")
-        return
-    }
-    if status.Completed {
-        fmt.Println("Macron: \"Cap sur le label, la Republique te soutient.\"")
-        g.StoryStage = stageLabel
-        return
-    }
-    banner("Palais presidentiel")
-    block(reader,
-        "Le palais ressemble a un plateau TV: marbre, drapeaux, cameras.",
-        "Emmanuel Macron ajuste son micro-cravate.",
-        "Macron: \"Montre-moi que tu connais la culture que tu defends.\"",
-    )
-    quiz := []struct{
-        q string
-        a string
-    }{
-        {"Annee du debut de la Revolution francaise ?", "1789"},
-        {"Devise inscrite sur les frontons francais ?", "liberte egalite fraternite"},
-        {"Compositeur de la Marseillaise ?", "rouget de lisle"},
+// Annonce les traits qui se debloquent au niveau atteint
+func (c *Character) announceTraits() {
+    for _, t := range traits[c.Name] {
+        if t.MinLevel == c.Level {
+            fmt.Printf("Nouveau trait pour %s: %s.\n", c.Name, c.traitLabel(t))
+        }
     }
-    for _, qa := range quiz {
-        fmt.Println(qa.q)
-        fmt.Print("Reponse: ")
-        raw := read(reader)
-        if g.consumeMenuReturn() {
-            return
+}
+
+// Recuperation de fin de tour des allies encore debout
+func endTurnTraits(party []*Character) {
+    for _, ch := range party {
+        if ch.HP <= 0 {
+            continue
         }
-        ans := strings.ToLower(strings.ReplaceAll(raw, "e", "e"))
-        ans = strings.ReplaceAll(ans, "'", "")
-        if ans != qa.a {
-            fmt.Println("Macron: \"Reviens avec plus de fond.\"")
-            return
+        if mp := min(ch.traitValue(traitManaRegen), ch.MaxMana-ch.Mana); mp > 0 {
+            ch.Mana += mp
+            fmt.Printf("%s reprend son souffle (+%d MP).\n", ch.Name, mp)
+        }
+        if hp := min(ch.traitValue(traitHPRegen), ch.MaxHP-ch.HP); hp > 0 {
+            ch.HP += hp
+            fmt.Printf("%s savoure le rappel du public (+%d HP).\n", ch.Name, hp)
         }
-        fmt.Println("Macron hoche la tete.")
     }
-    block(reader,
-        "La division strategique du label tente de couper l'entretien.",
-        "Macron: \"Je reste a tes cotes.\"",
-    )
-    g.fightSolo(reader, Enemy{Name: "Division strategique", Type: enemyCrew, MaxHP: 100, HP: 100, Attack: 11, CritTimer: 3, Style: "Lobby"}, battleOptions{
-        Intro:      []string{"Les conseillers du label projectent des slides marketing."},
-        Victory:    []string{"Macron brandit un badge d'acces dore."},
-        RewardXP:   55,
-        RewardGold: 12,
-    })
-    if g.consumeMenuReturn() {
+}
+
+// Tente une esquive passive de la cible
+func (g *Game) traitDodges(c *Character) bool {
+    if chance := c.traitValue(traitDodge); chance > 0 && g.rng.Intn(100) < chance {
+        fmt.Printf("%s esquive d'un pas de velours !\n", c.Name)
+        return true
+    }
+    return false
+}
+
+// Reduit les degats recus selon les traits d'encaisse (1 minimum)
+func (c *Character) traitGuard(dmg int) int {
+    if guard := c.traitValue(traitGuard); guard > 0 && dmg > 1 {
+        return max(dmg-guard, 1)
+    }
+    return dmg
+}
+
+// Renvoie une part des degats de corps a corps a l'attaquant
+func (c *Character) traitReflect(e *Enemy, dmg int) {
+    pct := c.traitValue(traitReflect)
+    if pct <= 0 || dmg <= 0 || e.HP <= 0 || rangedStyles[e.Style] {
         return
     }
-    if !g.Characters[2].Unlocked {
-        g.Characters[2].Unlocked = true
-        g.Characters[2].HP = g.Characters[2].MaxHP
-        g.Characters[2].Mana = g.Characters[2].MaxMana
-        fmt.Println("Macron rejoint votre equipe en tant que stratege.")
+    back := max(dmg*pct/100, 1)
+    e.HP = max(e.HP-back, 0)
+    fmt.Printf("%s renvoie %d degats a %s.\n", c.Name, back, e.Name)
+}
+
+// XP de victoire apres les traits du personnage
+func (c *Character) traitXP(xp int) int {
+    return xp * (100 + c.traitValue(traitXP)) / 100
+}
+
+// Or supplementaire rapporte par les traits des combattants
+func traitGoldBonus(party []*Character, gold int) int {
+    bonus := 0
+    for _, ch := range party {
+        if pct := ch.traitValue(traitGold); pct > 0 && gold > 0 {
+            extra := max(gold*pct/100, 1)
+            bonus += extra
+            fmt.Printf("%s negocie une prime de %d or.\n", ch.Name, extra)
+        }
     }
-    if g.active().addItem("pass_label") {
-        fmt.Println("Vous recevez le Pass presidentiel. Le QG peut maintenant s'ouvrir.")
+    return bonus
+}
+
+// Remise de trait appliquee chez le disquaire (allies debloques)
+func (g *Game) traitDiscount() int {
+    total := 0
+    for _, ch := range g.party() {
+        total += ch.traitValue(traitDiscount)
     }
-    g.ZoneStatus[zoneMacron] = ZoneStatus{Unlocked: true, Completed: true}
-    g.StoryStage = stageLabel
-    g.autoSave()
+    return total
 }
-// Combat final contre le label Pouler.fr
-func (g *Game) labelFinal(reader *bufio.Reader) {
-    if !g.ZoneStatus[zoneMacron].Completed {
-        fmt.Println("Rassemble Macron avant de prendre d'assaut le label.")
+
+// Paliers d'affinite d'un allie envers Miku (score cache sur 100)
+const (
+    affinityMax   = 100
+    affinityTalk  = 40
+    affinityCombo = 60
+    affinityBond  = 80
+)
+
+// Confidences debloquees a chaque palier
+var affinityScenes = map[string]map[int][]string{
+    "Kaaris": {
+        affinityTalk:  {"Kaaris: \"Avant le rap, je portais des cartons au marche. Le respect, ca se gagne caisse par caisse.\""},
+        affinityCombo: {"Kaaris: \"Monte sur mes epaules, Miku. On va leur montrer un duo qu'ils oublieront pas.\""},
+        affinityBond:  {"Kaaris: \"T'es de la famille maintenant. Le quartier le sait.\""},
+    },
+    "Emmanuel Macron": {
+        affinityTalk:  {"Macron: \"Je vous l'avoue: je chante faux. Mais j'ecoute juste.\""},
+        affinityCombo: {"Macron: \"Un meeting a deux voix, Miku. Vous le refrain, moi les applaudissements.\""},
+        affinityBond:  {"Macron: \"Quoi qu'il en coute, je reste a vos cotes.\""},
+    },
+    "Michael Jackson": {
+        affinityTalk:  {"MJ: \"Mon premier moonwalk, je l'ai rate devant mon miroir. Cent fois.\""},
+        affinityCombo: {"MJ: \"Suis mes pas, Miku. A deux, le sol n'existe plus.\""},
+        affinityBond:  {"MJ: \"Tu as ramene la magie. Je te dois ma prochaine chanson.\""},
+    },
+}
+
+// Ligne d'epilogue des allies tres proches de Miku
+var affinityEpilogues = map[string]string{
+    "Kaaris":          "Kaaris ouvre un studio gratuit au pied des tours, une photo de Miku au-dessus de la console.",
+    "Emmanuel Macron": "Macron fait inscrire la musique libre dans la Constitution, en chantant faux a la tribune.",
+    "Michael Jackson": "MJ et Miku sortent un duo surprise qui tourne en boucle dans Neonopolis.",
+}
+
+// Cadeaux preferes de chaque allie
+var giftLikes = map[string][]string{
+    "Kaaris":          {"potion_hp", "mat_troll", "casque_bagland"},
+    "Emmanuel Macron": {"autographe", "montre_berger", "potion_mana"},
+    "Michael Jackson": {"equip_glove", "mat_loup", "boost_x2"},
+}
+
+// Coeurs affiches pour l'affinite (5 coeurs de 20 points)
+func (c *Character) hearts() string {
+    full := c.Affinity / 20
+    return strings.Repeat("<3", full) + strings.Repeat("--", 5-full)
+}
+
+// Fait varier l'affinite cachee et joue la confidence des paliers franchis
+func (g *Game) gainAffinity(c *Character, delta int) {
+    if c == nil || c.Name == "Hatsune Miku" || delta == 0 {
         return
     }
-    party := g.party()
-    if len(party) < 4 {
-        fmt.Println("Forme d'abord ton quatuor legendaire.")
+    before := c.Affinity
+    c.Affinity = max(0, min(affinityMax, c.Affinity+delta))
+    for _, tier := range []int{affinityTalk, affinityCombo, affinityBond} {
+        if before >= tier || c.Affinity < tier {
+            continue
+        }
+        fmt.Printf("-- %s se confie (%s) --\n", c.Name, c.hearts())
+        for _, line := range affinityScenes[c.Name][tier] {
+            fmt.Println(line)
+        }
+        if tier == affinityCombo {
+            fmt.Printf("Nouvelle attaque en duo avec Miku pour %s !\n", c.Name)
+        }
+    }
+}
+
+// Applique l'affinite d'une issue de dialogue une seule fois par cycle (echec et reussite ont chacun leur drapeau)
+func (g *Game) dialogueAffinity(flag string, c *Character, delta int) {
+    if g.Flags[flag] {
         return
     }
-    banner("Chapitre 4 - Label Pouler.fr")
-    block(reader,
-        "Atrium du label: neon bleu, contrats encadres, foule captive.",
-        "Les quatre rivales de Miku se preparent a defendre leur monopole.",
-    )
-    if g.consumeMenuReturn() {
+    g.Flags[flag] = true
+    g.gainAffinity(c, delta)
+}
+
+// Les allies qui ont combattu ensemble se rapprochent de Miku
+func (g *Game) shareVictory(party []*Character) {
+    if len(party) < 2 {
         return
     }
-    waveOne := []Enemy{
-        {Name: "Megurine Luka", Type: enemyRival, MaxHP: 95, HP: 95, Attack: 11, CritTimer: 3, Style: "Pop aquatique"},
-        {Name: "Kagamine Rin", Type: enemyRival, MaxHP: 100, HP: 100, Attack: 12, CritTimer: 3, Style: "Electro rap"},
+    for _, ch := range party {
+        if ch.HP > 0 {
+            g.gainAffinity(ch, 2)
+        }
+    }
+}
+
+// Indique si le partenaire d'une attaque en duo est debout dans l'equipe
+func partnerReady(party []*Character, name string) bool {
+    for _, ch := range party {
+        if ch.Name == name && ch.HP > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// Offre un objet de la sacoche active a un allie recrute
+func (g *Game) giftMenu(reader *bufio.Reader) {
+    giver := g.active()
+    allies := []*Character{}
+    for _, ch := range g.party() {
+        if ch != giver && ch.Name != "Hatsune Miku" {
+            allies = append(allies, ch)
+        }
     }
-    if !g.fightParty(reader, party, waveOne, battleOptions{
-        Intro:      []string{"Luka lance une ballade hypnotique, Rin tranche avec des refrains rapides."},
-        Victory:    []string{"Rin: \"D'accord, Miku. Tu veux partager la scene... prouve-le.\""},
-        RewardXP:   60,
-        RewardGold: 15,
-    }) {
-        fmt.Println("Les rivales se moquent: \"Reviens avec plus de souffle.\"")
+    if len(allies) == 0 {
+        fmt.Println("Aucun allie a qui offrir un cadeau.")
         return
     }
-    shortRest(party)
-    fmt.Println("La loge improvisee rend 10 HP et 5 MP a chaque allie.")
-    waveTwo := []Enemy{
-        {Name: "Kagamine Len", Type: enemyRival, MaxHP: 115, HP: 115, Attack: 13, CritTimer: 2, Style: "Rock urbain"},
-        {Name: "KAITO", Type: enemyRival, MaxHP: 125, HP: 125, Attack: 14, CritTimer: 3, Style: "Classique glace"},
+    if len(giver.Inventory) == 0 {
+        fmt.Println("Votre sacoche est vide.")
+        return
     }
-    if !g.fightParty(reader, party, waveTwo, battleOptions{
-        Intro:      []string{"Len sort une guitare electrique, KAITO dresse un mur symphonique."},
-        Victory:    []string{"KAITO: \"La scene n'appartient a personne. Gagne ton final.\""},
-        RewardXP:   70,
-        RewardGold: 18,
-    }) {
-        fmt.Println("Len: \"On vous attend pour une vraie bagarre.\"")
+    idx := g.pickStack(reader, "Cadeau a offrir", giver.Inventory)
+    if idx < 0 {
         return
     }
-    block(reader,
-        "Mattieu Berger et Sylvain Bagland applaudissent avec arrogance.",
-        "Ils declenchent des cages de verre autour de tes allies.",
-        "Miku se retrouve seule au centre de la scene.",
-    )
-    solo := []*Character{g.Characters[0]}
-    g.Characters[0].resetCombatFlags()
-    bosses := []Enemy{
-        {Name: "Mattieu Berger", Type: enemyBoss, MaxHP: 165, HP: 165, Attack: 15, CritTimer: 3, Style: "Business"},
-        {Name: "Sylvain Bagland", Type: enemyBoss, MaxHP: 155, HP: 155, Attack: 15, CritTimer: 2, Style: "Business"},
+    fmt.Println("A qui ?")
+    for i, ch := range allies {
+        fmt.Printf("%d) %s %s\n", i+1, ch.Name, ch.hearts())
     }
-    if !g.fightParty(reader, solo, bosses, battleOptions{
-        Intro: []string{"Berger: \"Sans ta cassette tu n'es rien.\"", "Bagland: \"La musique se monetise, point.\""},
-        Victory: []string{"La cassette legendaire scintille de nouveau entre les mains de Miku."},
-        Defeat:  []string{"Berger: \"Le marche decide. Reviens avec plus de fans.\""},
-        RewardXP:   120,
-        RewardGold: 25,
-        IsBoss:     true,
-    }) {
-        fmt.Println("Les dirigeants sourient: \"On te verra a la prochaine sortie.\"")
+    fmt.Print("Choix: ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() {
         return
     }
-    block(reader,
-        "Les cages explosent, tes allies te rejoignent.",
-        "Miku remet la cassette dans son lecteur: le monde entier recoit a nouveau des melodies libres.",
-        "La vraie musique appartient aux artistes et au public, pas aux labels.",
-    )
-    if g.consumeMenuReturn() {
+    if err != nil || choice < 1 || choice > len(allies) {
+        fmt.Println("Choix invalide.")
         return
     }
-    g.StoryStage = stageFinish
-    g.autoSave()
-}
-// Valeur d'attaque de base selon le personnage
-func baseAttack(c *Character) int {
-    switch c.Name {
-    case "Kaaris":
-        return 12
-    case "Michael Jackson":
-        return 10
-    case "Emmanuel Macron":
-        return 9
-    default:
-        return 9
+    ally := allies[choice-1]
+    st := giver.Inventory.takeQty(idx, 1)
+    gain := max(2, min(10, itemValue(st.ID)/4))
+    if slices.Contains(giftLikes[ally.Name], st.ID) {
+        gain *= 2
+        fmt.Printf("%s adore %s !\n", ally.Name, items[st.ID].Name)
+    } else {
+        fmt.Printf("%s accepte %s avec un sourire.\n", ally.Name, items[st.ID].Name)
     }
+    g.gainAffinity(ally, gain)
 }
 
-
 // Gere les capacites speciales contextuelles
-func (g *Game) performSpecial(reader *bufio.Reader, c *Character, enemy *Enemy, party []*Character) (bool, bool) {
+func (g *Game) performSpecial(reader *bufio.Reader, c *Character, party []*Character, enemies []Enemy) (bool, bool) {
     if c == nil {
         return false, false
     }
-    switch c.Name {
-    case "Hatsune Miku":
-        if !c.HasNoteSpell {
-            fmt.Println("Miku n'a pas encore retrouve la note explosive.")
-            return false, false
-        }
-        if enemy == nil {
-            fmt.Println("Aucune cible a pulveriser.")
-            return false, false
-        }
-        cost := 15
-        if c.Mana < cost {
-            fmt.Println("Pas assez de mana pour la note explosive legendaire.")
-            return false, false
+    moves := []specialMove{}
+    for _, m := range specials[c.Name] {
+        if m.Skill != "" && !c.Skills[m.Skill] {
+            continue
         }
-        c.Mana -= cost
-        dmg := 30 + g.rng.Intn(11)
-        if c.BattleBoost > 0 {
-            dmg *= c.BattleBoost
+        if m.Duo != "" && (c.Affinity < affinityCombo || !partnerReady(party, m.Duo)) {
+            continue
         }
-        if c.IgnoreGuard {
-            dmg += 8
-            c.IgnoreGuard = false
+        moves = append(moves, m)
+    }
+    if len(moves) == 0 {
+        fmt.Println("Pas de capacite speciale propre.")
+        return false, false
+    }
+    move := moves[0]
+    if len(moves) > 1 {
+        if prompt, ok := specialPrompts[c.Name]; ok {
+            fmt.Println(prompt)
         }
-        enemy.HP -= dmg
-        if enemy.HP < 0 {
-            enemy.HP = 0
+        for i, m := range moves {
+            cost := "0 MP"
+            if m.Cost > 0 {
+                cost = fmt.Sprintf("-%d MP", c.specialCost(m.Cost))
+            }
+            fmt.Printf("%d) %s (%s, %s)\n", i+1, m.Name, cost, targetLabel(m.Target))
         }
-        fmt.Printf("Miku declenche la note explosive legendaire (-%d HP).\n", dmg)
-        c.SpecialUsed = true
-        return true, true
-    case "Kaaris":
-        fmt.Println("Kaaris: \"On choisit quoi ?\"")
-        fmt.Println("1) Crew devastateur (0 MP)")
-        fmt.Println("2) Bouclier de rue (-10 MP)")
-        fmt.Println("3) Mur du crew (-18 MP)")
         fmt.Print("Choix: ")
-        choice := read(reader)
-        if g.consumeMenuReturn() {
+        choice, err := strconv.Atoi(read(reader))
+        if g.menuReturnRequested {
             return false, false
         }
-        switch choice {
-        case "1":
-            if enemy == nil {
-                fmt.Println("Pas de cible pour frapper.")
-                return false, false
-            }
-            dmg := 34 + g.rng.Intn(13)
-            if c.BattleBoost > 0 {
-                dmg *= c.BattleBoost
-            }
-            if c.IgnoreGuard {
-                dmg += 10
-                c.IgnoreGuard = false
-            }
-            enemy.HP -= dmg
-            if enemy.HP < 0 {
-                enemy.HP = 0
-            }
-            fmt.Printf("Kaaris invoque son crew (-%d HP).\n", dmg)
-            c.SpecialUsed = true
-            return true, true
-        case "2":
-            cost := 10
-            if c.Mana < cost {
-                fmt.Println("Pas assez de mana pour lever le bouclier.")
-                return false, false
-            }
-            c.Mana -= cost
-            shield := 24
-            c.ShieldHP += shield
-            fmt.Printf("Un bouclier d'acier entoure %s (+%d HP absorbables).\n", c.Name, shield)
-            c.SpecialUsed = true
-            return true, true
-        case "3":
-            cost := 18
-            if c.Mana < cost {
-                fmt.Println("Pas assez de mana pour proteger tout le monde.")
-                return false, false
-            }
-            c.Mana -= cost
-            applied := 0
-            for _, ally := range party {
-                if ally == nil || ally.HP <= 0 {
-                    continue
-                }
-                ally.ShieldHP += 18
-                applied++
-            }
-            if applied == 0 {
-                fmt.Println("Personne a proteger.")
-                return false, false
-            }
-            if applied == 1 {
-                fmt.Println("Le crew forme un bouclier autour de toi (+18 HP absorbables).")
-            } else {
-                fmt.Println("Le crew erige un mur protecteur pour l'equipe (+18 HP absorbables chacun).")
-            }
-            c.SpecialUsed = true
-            return true, true
-        default:
+        if err != nil || choice < 1 || choice > len(moves) {
             fmt.Println("Choix invalide.")
             return false, false
         }
-    case "Emmanuel Macron":
-        if enemy == nil {
-            fmt.Println("Aucune cible politique en face.")
-            return false, false
+        move = moves[choice-1]
+    }
+    if move.Unlock != nil && !move.Unlock(c) {
+        fmt.Println(move.Locked)
+        return false, false
+    }
+    if c.Mana < c.specialCost(move.Cost) {
+        fmt.Println(move.NoMana)
+        return false, false
+    }
+    targets, abort := g.resolveTargets(reader, move.Target, c, party, enemies)
+    if abort {
+        g.menuReturnRequested = true
+        return false, false
+    }
+    if targets.empty() {
+        return false, false
+    }
+    c.Mana -= c.specialCost(move.Cost)
+    consume := move.Run(g, c, targets)
+    c.SpecialUsed = true
+    return true, consume
+}
+
+
+// Pari annexe propose avant un combat
+type sideBet struct {
+    Kind  string
+    Label string
+    Turns int
+    Odds  float64
+    Stake int
+}
+
+const (
+    sideBetTurns = "turns"
+    sideBetNoKO  = "no_ko"
+    sideBetNyan  = "nyan"
+)
+
+// Paris engages sur un combat
+type betSlip struct {
+    Wallet *Character
+    Tier   int
+    Stake  int
+    Odds   float64
+    Sides  []sideBet
+}
+
+// Deroule d'un combat utile pour regler les paris
+type battleOutcome struct {
+    Won      bool
+    Turns    int
+    AllyKO   bool
+    Finisher string
+}
+
+// Bilan des paris d'un profil sur toute sa carriere
+type BetLedger struct {
+    Placed   int
+    Won      int
+    Lost     int
+    Staked   int
+    Returned int
+    BestWin  int
+    MaxTier  int
+}
+
+func (l BetLedger) profit() int {
+    return l.Returned - l.Staked
+}
+
+// Puissance estimee d'une equipe pour le calcul des cotes
+func partyPower(party []*Character) int {
+    power := 0
+    for _, ch := range party {
+        if ch == nil || ch.HP <= 0 {
+            continue
         }
-        fmt.Println("Macron: \"Quelle tactique ?\"")
-        fmt.Println("1) Discours manipulateur (-12 MP)")
-        fmt.Println("2) Interdiction de chanter (-14 MP)")
-        fmt.Print("Choix: ")
-        choice := read(reader)
-        if g.consumeMenuReturn() {
-            return false, false
+        power += ch.HP + baseAttack(ch)*6 + ch.Mana/2 + ch.ShieldHP
+    }
+    return power
+}
+
+// Puissance estimee d'un groupe d'ennemis
+func enemyPower(enemies []Enemy) int {
+    power := 0
+    for _, e := range enemies {
+        if e.HP <= 0 {
+            continue
         }
-        switch choice {
-        case "1":
-            cost := 12
-            if c.Mana < cost {
-                fmt.Println("Pas assez d'energie pour le discours manipulateur.")
-                return false, false
-            }
-            c.Mana -= cost
-            if enemy.WeakenTurns < 2 {
-                enemy.WeakenTurns = 2
-            }
-            fmt.Printf("Macron deboussole %s : ses degats sont divises pendant 2 tours.\n", enemy.Name)
-            c.SpecialUsed = true
-            return true, true
-        case "2":
-            cost := 14
-            if c.Mana < cost {
-                fmt.Println("Pas assez d'energie pour l'interdiction de chanter.")
-                return false, false
-            }
-            c.Mana -= cost
-            enemy.SilenceTurns = 1
-            fmt.Printf("%s recoit une interdiction de chanter et ne pourra pas attaquer ce tour-ci.\n", enemy.Name)
-            c.SpecialUsed = true
-            return true, false
-        default:
-            fmt.Println("Choix invalide.")
-            return false, false
+        power += e.HP + e.Attack*6
+    }
+    return power
+}
+
+// Cote de victoire proposee selon le rapport de force
+func matchupOdds(party []*Character, enemies []Enemy) float64 {
+    mine := partyPower(party)
+    if mine <= 0 {
+        mine = 1
+    }
+    ratio := float64(enemyPower(enemies)) / float64(mine)
+    odds := 1.1 + ratio*1.5
+    odds = math.Max(1.2, math.Min(6.0, odds))
+    return math.Round(odds*10) / 10
+}
+
+// Estime le nombre de tours necessaires pour vaincre les ennemis
+func estimateTurns(party []*Character, enemies []Enemy) int {
+    dmg := 0
+    for _, ch := range party {
+        if ch != nil && ch.HP > 0 {
+            dmg += baseAttack(ch) + 2
         }
-    case "Michael Jackson":
-        fmt.Println("MJ: \"Choisis ton groove.\"")
-        fmt.Println("1) Moonwalk offensif (-8 MP)")
-        fmt.Println("2) Beat therapy (-12 MP, soin perso)")
-        fmt.Println("3) Harmonie partagee (-18 MP, soigne l'equipe)")
-        fmt.Print("Choix: ")
-        choice := read(reader)
-        if g.consumeMenuReturn() {
-            return false, false
+    }
+    if dmg <= 0 {
+        dmg = 1
+    }
+    hp := 0
+    for _, e := range enemies {
+        hp += e.HP
+    }
+    return (hp+dmg-1)/dmg + 1
+}
+
+// Renforce un ennemi selon le palier de risque choisi
+func scaleForBet(e *Enemy, tier int) {
+    if tier <= 1 {
+        return
+    }
+    e.MaxHP *= tier
+    e.HP = e.MaxHP
+    e.Attack = int(float64(e.Attack) * math.Sqrt(float64(tier)))
+}
+
+// Demande une mise entre 0 et le solde disponible
+func (g *Game) askStake(reader *bufio.Reader, prompt string, wallet *Character) (int, bool) {
+    for {
+        fmt.Printf("%s (0-%d): ", prompt, wallet.BetPts)
+        input := read(reader)
+        if g.menuReturnRequested {
+            return 0, true
         }
-        switch choice {
-        case "1":
-            if enemy == nil {
-                fmt.Println("Le moonwalk attend un adversaire.")
-                return false, false
-            }
-            cost := 8
-            if c.Mana < cost {
-                fmt.Println("Pas assez d'energie pour le moonwalk.")
-                return false, false
-            }
-            c.Mana -= cost
-            dmg := 20 + g.rng.Intn(9)
-            if c.BattleBoost > 0 {
-                dmg *= c.BattleBoost
-            }
-            if c.IgnoreGuard {
-                dmg += 6
-                c.IgnoreGuard = false
-            }
-            enemy.HP -= dmg
-            if enemy.HP < 0 {
-                enemy.HP = 0
-            }
-            c.DodgeNext = true
-            fmt.Printf("MJ glisse en moonwalk et inflige %d degats. Il esquivera le prochain coup.\n", dmg)
-            c.SpecialUsed = true
-            return true, true
-        case "2":
-            cost := 12
-            if c.Mana < cost {
-                fmt.Println("Pas assez d'energie pour ce solo.")
-                return false, false
-            }
-            c.Mana -= cost
-            heal := 32
-            c.HP += heal
-            if c.HP > c.MaxHP {
-                c.HP = c.MaxHP
-            }
-            fmt.Printf("MJ improvise un solo apaisant et se soigne (+%d HP).\n", heal)
-            c.SpecialUsed = true
-            return true, true
-        case "3":
-            cost := 18
-            if c.Mana < cost {
-                fmt.Println("Pas assez d'energie pour harmoniser l'equipe.")
-                return false, false
-            }
-            c.Mana -= cost
-            healed := 0
-            for _, ally := range party {
-                if ally == nil || ally.HP <= 0 {
-                    continue
-                }
-                gain := 20
-                ally.HP += gain
-                if ally.HP > ally.MaxHP {
-                    ally.HP = ally.MaxHP
-                }
-                healed++
-            }
-            if healed == 0 {
-                fmt.Println("Personne n'est en etat de profiter de l'harmonie.")
-                return false, false
+        if input == "" {
+            return 0, false
+        }
+        stake, err := strconv.Atoi(input)
+        if err == nil && stake >= 0 && stake <= wallet.BetPts {
+            return stake, false
+        }
+        fmt.Println("Mise invalide.")
+    }
+}
+
+// Guichet des paris avant un combat: mise principale, palier de risque et paris annexes
+func (g *Game) placeBets(reader *bufio.Reader, party []*Character, enemies []Enemy) (*betSlip, bool) {
+    wallet := g.active()
+    if wallet.BetPts <= 0 {
+        return nil, false
+    }
+    fmt.Println("\n=== Guichet des paris ===")
+    fmt.Printf("Points de mise disponibles: %d\n", wallet.BetPts)
+    fmt.Printf("Cote de victoire: x%.1f\n", matchupOdds(party, enemies))
+    stake, abort := g.askStake(reader, "Mise sur la victoire", wallet)
+    if abort || stake == 0 {
+        return nil, abort
+    }
+    slip := &betSlip{Wallet: wallet, Tier: 1, Stake: stake}
+    wallet.BetPts -= stake
+    fmt.Print("Palier de risque 1-4 (ennemis renforces, recompenses multipliees) [1]: ")
+    switch read(reader) {
+    case "2":
+        slip.Tier = 2
+    case "3":
+        slip.Tier = 3
+    case "4":
+        slip.Tier = 4
+    }
+    if g.menuReturnRequested {
+        wallet.BetPts += stake
+        return nil, true
+    }
+    for i := range enemies {
+        scaleForBet(&enemies[i], slip.Tier)
+    }
+    slip.Odds = matchupOdds(party, enemies)
+    fmt.Printf("Palier x%d | cote finale x%.1f | gain potentiel %d pts\n", slip.Tier, slip.Odds, int(math.Round(float64(stake)*slip.Odds)))
+
+    offers := []sideBet{
+        {Kind: sideBetTurns, Turns: estimateTurns(party, enemies), Odds: 2.5},
+    }
+    offers[0].Label = fmt.Sprintf("Victoire en moins de %d tours", offers[0].Turns)
+    if len(party) > 1 {
+        offers = append(offers, sideBet{Kind: sideBetNoKO, Label: "Aucun allie KO", Odds: 1.8})
+    }
+    for _, ch := range party {
+        if ch.Name == "Hatsune Miku" {
+            offers = append(offers, sideBet{Kind: sideBetNyan, Label: "Finir avec le Nyan Cat", Odds: 3.0})
+            break
+        }
+    }
+    taken := map[int]bool{}
+    for wallet.BetPts > 0 && len(taken) < len(offers) {
+        fmt.Println("Paris annexes:")
+        for i, offer := range offers {
+            if taken[i] {
+                continue
             }
-            fmt.Println("Le choeur de MJ guerit l'equipe (+20 HP chacun).")
-            c.SpecialUsed = true
-            return true, true
-        default:
-            fmt.Println("Choix invalide.")
-            return false, false
+            fmt.Printf("%d) %s (cote x%.1f)\n", i+1, offer.Label, offer.Odds)
         }
-    default:
-        fmt.Println("Pas de capacite speciale propre.")
-        return false, false
+        fmt.Print("Pari annexe (0 pour lancer le combat): ")
+        choice, err := strconv.Atoi(read(reader))
+        if g.menuReturnRequested {
+            g.refundBets(slip)
+            return nil, true
+        }
+        if err != nil || choice <= 0 || choice > len(offers) || taken[choice-1] {
+            break
+        }
+        side, abort := g.askStake(reader, "Mise", wallet)
+        if abort {
+            g.refundBets(slip)
+            return nil, true
+        }
+        if side == 0 {
+            continue
+        }
+        offer := offers[choice-1]
+        offer.Stake = side
+        wallet.BetPts -= side
+        slip.Sides = append(slip.Sides, offer)
+        taken[choice-1] = true
     }
+    return slip, false
 }
 
+// Rembourse des paris annules avant le combat
+func (g *Game) refundBets(slip *betSlip) {
+    if slip == nil {
+        return
+    }
+    slip.Wallet.BetPts += slip.Stake
+    for _, side := range slip.Sides {
+        slip.Wallet.BetPts += side.Stake
+    }
+}
 
+// Regle les paris a la fin d'un combat et met a jour le bilan du profil
+func (g *Game) settleBets(slip *betSlip, out battleOutcome) {
+    if slip == nil {
+        return
+    }
+    fmt.Println("-- Reglement des paris --")
+    g.Bets.Placed++
+    if slip.Tier > g.Bets.MaxTier && out.Won {
+        g.Bets.MaxTier = slip.Tier
+    }
+    settle := func(label string, stake int, odds float64, won bool) {
+        g.Bets.Staked += stake
+        if !won {
+            fmt.Printf("%s: perdu (-%d pts)\n", label, stake)
+            g.Bets.Lost++
+            return
+        }
+        payout := int(math.Round(float64(stake) * odds))
+        slip.Wallet.BetPts += payout
+        g.Bets.Returned += payout
+        g.Bets.Won++
+        if payout-stake > g.Bets.BestWin {
+            g.Bets.BestWin = payout - stake
+        }
+        fmt.Printf("%s: gagne (+%d pts)\n", label, payout)
+    }
+    settle("Victoire", slip.Stake, slip.Odds, out.Won)
+    if out.Won && slip.Tier == 4 {
+        g.unlockAchievement("pari_x4")
+    }
+    for _, side := range slip.Sides {
+        won := out.Won
+        switch side.Kind {
+        case sideBetTurns:
+            won = won && out.Turns < side.Turns
+        case sideBetNoKO:
+            won = won && !out.AllyKO
+        case sideBetNyan:
+            won = won && out.Finisher == sideBetNyan
+        }
+        settle(side.Label, side.Stake, side.Odds, won)
+    }
+    fmt.Printf("Points de mise: %d\n", slip.Wallet.BetPts)
+}
 
+// Affiche le bilan des paris du profil
+func (g *Game) printBetLedger() {
+    l := g.Bets
+    fmt.Println("-- Bilan des paris --")
+    if l.Placed == 0 {
+        fmt.Println("Aucun pari engage pour l'instant.")
+        return
+    }
+    fmt.Printf("Combats paries: %d | Paris gagnes: %d | Paris perdus: %d\n", l.Placed, l.Won, l.Lost)
+    fmt.Printf("Mises: %d pts | Gains: %d pts | Bilan: %+d pts | Meilleur gain: %d pts\n", l.Staked, l.Returned, l.profit(), l.BestWin)
+}
 
 // Boucle de combat pour les duels
 func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions) bool {
     player := g.active()
-    player.resetCombatFlags()
-    enemy.HP = enemy.MaxHP
-    if enemy.CritTimer <= 0 {
-        enemy.CritTimer = 3
+    if player.HP <= 0 {
+        fmt.Printf("%s est KO et ne peut pas combattre. Relevez-le avec un Rappel du public ou changez de personnage.\n", player.Name)
+        return false
     }
-    enemy.SilenceTurns = 0
+    g.region = opts.region()
+    g.observed = map[string]bool{}
+    player.resetCombatFlags()
+    player.applySetOpeners()
+    itemsBefore := g.itemsUsed
+    field := []Enemy{enemy}
+    foe := &field[0]
+    prepareEnemy(foe)
+    g.scaleEnemy(foe)
+    g.noteEncounter(*foe)
     for _, line := range opts.Intro {
         fmt.Println("[INFO]", line)
     }
-    bet := 1
-    if opts.AllowBet && player.BetPts > 0 {
-        fmt.Printf("Points de mise disponibles: %d (0 aucun, 2/3/4 pour miser) -> ", player.BetPts)
-        betInput := read(reader)
-        if g.consumeMenuReturn() {
-            fmt.Println("Retour au menu principal.")
-            return false
-        }
-        switch betInput {
-        case "2":
-            if player.BetPts >= 2 {
-                bet = 2
-            }
-        case "3":
-            if player.BetPts >= 3 {
-                bet = 3
-            }
-        case "4":
-            if player.BetPts >= 4 {
-                bet = 4
-            }
+    bet := 1
+    var slip *betSlip
+    if opts.AllowBet {
+        placed, abort := g.placeBets(reader, []*Character{player}, field)
+        if abort {
+            g.consumeMenuReturn()
+            fmt.Println("Retour au menu principal.")
+            return false
+        }
+        if placed != nil {
+            slip = placed
+            bet = slip.Tier
         }
     }
-    enemy.HP *= bet
-    enemy.MaxHP = enemy.HP
-    enemy.Attack = int(float64(enemy.Attack) * math.Sqrt(float64(bet)))
+    // Un combat quitte ou fui compte comme un pari perdu
+    settled := false
+    defer func() {
+        if !settled {
+            g.settleBets(slip, battleOutcome{})
+        }
+        g.noteBattle()
+        g.checkAchievements()
+    }()
+    finisher := ""
     turn := 1
-    for enemy.HP > 0 && player.HP > 0 {
-        showSoloHud(player, &enemy)
+    for foe.HP > 0 && player.HP > 0 {
+        g.checkpoint()
+        showSoloHud(player, foe)
         fmt.Printf("Tour %d\n", turn)
         hasNyan := player.Name == "Hatsune Miku"
         fmt.Println("1) Attaquer")
         if player.HasNoteSpell {
-            fmt.Println("2) Note explosive")
+            fmt.Printf("2) Note explosive (%d MP)\n", player.noteCost())
         } else {
             fmt.Println("2) Note explosive (verrouille)")
         }
         if hasNyan {
-            fmt.Println("3) Attaque Nyan Cat")
+            fmt.Printf("3) Attaque Nyan Cat (%d MP)\n", player.nyanCost())
             fmt.Println("4) Capacite speciale")
             fmt.Println("5) Inventaire")
             fmt.Println("6) Observer")
@@ -1772,6 +6701,7 @@ func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions)
             return false
         }
         consumeTurn := true
+        lastAction := ""
         switch action {
         case "1":
             dmg := baseAttack(player) + g.rng.Intn(4)
@@ -1782,21 +6712,23 @@ func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions)
                 dmg += 6
                 player.IgnoreGuard = false
             }
-            enemy.HP -= dmg
-            if enemy.HP < 0 {
-                enemy.HP = 0
+            dmg = g.gearCrit(player, dmg)
+            foe.HP -= dmg
+            if foe.HP < 0 {
+                foe.HP = 0
             }
             fmt.Printf("%s inflige %d degats.\n", player.Name, dmg)
+            player.gearOnHit(foe)
         case "2":
             if !player.HasNoteSpell {
                 fmt.Println("Vous n'avez pas encore appris ce sort.")
                 consumeTurn = false
-            } else if player.Mana < 10 {
+            } else if player.Mana < player.noteCost() {
                 fmt.Println("Pas assez de mana.")
                 consumeTurn = false
             } else {
-                player.Mana -= 10
-                dmg := 18 + g.rng.Intn(6)
+                player.Mana -= player.noteCost()
+                dmg := 18 + g.rng.Intn(6) + player.skillBonus().NoteDamage
                 if player.BattleBoost > 0 {
                     dmg *= player.BattleBoost
                 }
@@ -1804,21 +6736,21 @@ func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions)
                     dmg += 8
                     player.IgnoreGuard = false
                 }
-                enemy.HP -= dmg
-                if enemy.HP < 0 {
-                    enemy.HP = 0
+                foe.HP -= dmg
+                if foe.HP < 0 {
+                    foe.HP = 0
                 }
                 fmt.Printf("Note explosive inflige %d degats.\n", dmg)
             }
         case "3":
             if hasNyan {
-                manaCost := 16
+                manaCost := player.nyanCost()
                 if player.Mana < manaCost {
                     fmt.Println("Pas assez de mana pour invoquer Nyan Cat.")
                     consumeTurn = false
                 } else {
                     player.Mana -= manaCost
-                    dmg := 26 + g.rng.Intn(8)
+                    dmg := 26 + g.rng.Intn(8) + player.skillBonus().NyanDamage
                     if player.BattleBoost > 0 {
                         dmg *= player.BattleBoost
                     }
@@ -1826,18 +6758,19 @@ func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions)
                         dmg += 10
                         player.IgnoreGuard = false
                     }
-                    enemy.HP -= dmg
-                    if enemy.HP < 0 {
-                        enemy.HP = 0
+                    foe.HP -= dmg
+                    if foe.HP < 0 {
+                        foe.HP = 0
                     }
                     fmt.Printf("Nyan Cat dechaine son arc-en-ciel et inflige %d degats !\n", dmg)
+                    lastAction = sideBetNyan
                 }
             } else {
                 if player.SpecialUsed {
                     fmt.Println("Capacite deja utilisee.")
                     consumeTurn = false
                 } else {
-                    used, consume := g.performSpecial(reader, player, &enemy, []*Character{player})
+                    used, consume := g.performSpecial(reader, player, []*Character{player}, field)
                     if g.consumeMenuReturn() {
                         fmt.Println("Retour au menu principal.")
                         return false
@@ -1855,7 +6788,7 @@ func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions)
                     fmt.Println("Capacite deja utilisee.")
                     consumeTurn = false
                 } else {
-                    used, consume := g.performSpecial(reader, player, &enemy, []*Character{player})
+                    used, consume := g.performSpecial(reader, player, []*Character{player}, field)
                     if g.consumeMenuReturn() {
                         fmt.Println("Retour au menu principal.")
                         return false
@@ -1867,7 +6800,7 @@ func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions)
                     }
                 }
             } else {
-                if !g.useInventory(reader, player, &enemy, nil) {
+                if !g.useInventory(reader, player, []*Character{player}, field, false) {
                     consumeTurn = false
                 }
                 if g.consumeMenuReturn() {
@@ -1877,7 +6810,7 @@ func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions)
             }
         case "5":
             if hasNyan {
-                if !g.useInventory(reader, player, &enemy, nil) {
+                if !g.useInventory(reader, player, []*Character{player}, field, false) {
                     consumeTurn = false
                 }
                 if g.consumeMenuReturn() {
@@ -1885,12 +6818,14 @@ func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions)
                     return false
                 }
             } else {
-                fmt.Printf("%s (%s) HP %d/%d | ATK %d\n", enemy.Name, enemy.Style, enemy.HP, enemy.MaxHP, enemy.Attack)
+                fmt.Printf("%s (%s) HP %d/%d | ATK %d\n", foe.Name, foe.Style, foe.HP, foe.MaxHP, foe.Attack)
+                g.observe(*foe)
                 consumeTurn = false
             }
         case "6":
             if hasNyan {
-                fmt.Printf("%s (%s) HP %d/%d | ATK %d\n", enemy.Name, enemy.Style, enemy.HP, enemy.MaxHP, enemy.Attack)
+                fmt.Printf("%s (%s) HP %d/%d | ATK %d\n", foe.Name, foe.Style, foe.HP, foe.MaxHP, foe.Attack)
+                g.observe(*foe)
                 consumeTurn = false
             } else if opts.AllowEscape {
                 fmt.Println("Vous battez en retraite.")
@@ -1916,76 +6851,84 @@ func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions)
             consumeTurn = false
         }
 
-        if enemy.HP <= 0 {
+        if foe.HP <= 0 {
+            finisher = lastAction
             break
         }
 
         if consumeTurn {
-            if enemy.PoisonTurns > 0 {
-                enemy.HP -= enemy.PoisonDmg
-                if enemy.HP < 0 {
-                    enemy.HP = 0
+            if foe.PoisonTurns > 0 {
+                foe.HP -= foe.PoisonDmg
+                if foe.HP < 0 {
+                    foe.HP = 0
                 }
-                fmt.Printf("Le poison ronge %s (-%d HP).\n", enemy.Name, enemy.PoisonDmg)
-                enemy.PoisonTurns--
-                if enemy.HP <= 0 {
+                fmt.Printf("Le poison ronge %s (-%d HP).\n", foe.Name, foe.PoisonDmg)
+                foe.PoisonTurns--
+                if foe.HP <= 0 {
                     break
                 }
             }
-            if enemy.SilenceTurns > 0 {
-                fmt.Printf("%s est reduit au silence et ne peut pas attaquer.\n", enemy.Name)
-                enemy.SilenceTurns--
-                if enemy.CritTimer > 1 {
-                    enemy.CritTimer--
+            if foe.SilenceTurns > 0 {
+                fmt.Printf("%s est reduit au silence et ne peut pas attaquer.\n", foe.Name)
+                foe.SilenceTurns--
+                if foe.CritTimer > 1 {
+                    foe.CritTimer--
                 }
                 turn++
                 continue
             }
-            dmg := enemy.Attack
-            if enemy.WeakenTurns > 0 {
+            dmg := foe.Attack
+            if foe.WeakenTurns > 0 {
                 dmg = int(math.Round(float64(dmg) * 0.6))
                 if dmg < 1 {
                     dmg = 1
                 }
-                enemy.WeakenTurns--
+                foe.WeakenTurns--
             }
-            if enemy.CritTimer <= 1 {
+            if foe.CritTimer <= 1 {
                 dmg *= 2
-                enemy.CritTimer = 3
+                foe.CritTimer = foe.CritEvery
                 fmt.Println("L'ennemi place un critique !")
             } else {
-                enemy.CritTimer--
+                foe.CritTimer--
             }
             if player.DodgeNext {
                 fmt.Printf("%s esquive le coup !\n", player.Name)
                 player.DodgeNext = false
-            } else {
-                dmg = absorbShieldDamage(player, dmg)
+            } else if !g.traitDodges(player) {
+                dmg = absorbShieldDamage(player, player.traitGuard(dmg))
                 if dmg > 0 {
                     player.HP -= dmg
                     if player.HP < 0 {
                         player.HP = 0
                     }
                     fmt.Printf("%s subit %d degats.\n", player.Name, dmg)
+                    player.traitReflect(foe, dmg)
                 }
             }
+            endTurnTraits([]*Character{player})
         }
         turn++
     }
-    if enemy.HP <= 0 {
+    if foe.HP <= 0 {
         fmt.Println("Victoire !")
-        xpGain := opts.RewardXP * bet
+        xpGain := g.scaleReward(opts.RewardXP * bet)
         if xpGain > 0 {
-            player.gainXP(xpGain)
+            player.gainXP(player.traitXP(xpGain))
+            g.shareBenchXP([]*Character{player}, xpGain)
         }
-        goldGain := opts.RewardGold * bet
+        goldGain := g.scaleReward(opts.RewardGold * bet)
+        goldGain += traitGoldBonus([]*Character{player}, goldGain)
         if goldGain > 0 {
             g.Gold += goldGain
         }
-        if opts.AllowBet && bet > 1 {
-            player.BetPts += bet - 1
-            fmt.Printf("Gain de mise: +%d (total %d).\n", bet-1, player.BetPts)
-        }
+        settled = true
+        g.settleBets(slip, battleOutcome{Won: true, Turns: turn, Finisher: finisher})
+        g.gainFame(g.region, victoryFame(opts))
+        g.Wins++
+        g.questDuel(*foe, g.itemsUsed > itemsBefore)
+        g.noteDefeats(field)
+        g.questKills(field)
         if opts.RewardBetPts > 0 {
             player.BetPts += opts.RewardBetPts * bet
             fmt.Printf("Points de mise bonus: +%d.\n", opts.RewardBetPts*bet)
@@ -1993,19 +6936,17 @@ func (g *Game) fightSolo(reader *bufio.Reader, enemy Enemy, opts battleOptions)
         if goldGain > 0 || xpGain > 0 {
             fmt.Printf("Recompenses: +%d or | +%d XP\n", goldGain, xpGain)
         }
+        g.grantLoot(reader, player, field)
         for _, line := range opts.Victory {
             fmt.Println(line)
         }
         return true
     }
     fmt.Println("Defaite...")
-    player.reviveIfNeeded()
-    if opts.AllowBet && bet > 1 {
-        player.BetPts -= bet
-        if player.BetPts < 0 {
-            player.BetPts = 0
-        }
-    }
+    g.reviveIfNeeded(player)
+    g.checkIronmanWipe(foe.Name)
+    settled = true
+    g.settleBets(slip, battleOutcome{Turns: turn, AllyKO: true})
     for _, line := range opts.Defeat {
         fmt.Println(line)
     }
@@ -2024,6 +6965,26 @@ func allEnemiesDown(enemies []Enemy) bool {
     return true
 }
 
+// Compte les ennemis encore debout sur le terrain
+func aliveEnemies(enemies []Enemy) int {
+    alive := 0
+    for _, e := range enemies {
+        if e.HP > 0 {
+            alive++
+        }
+    }
+    return alive
+}
+
+// Remet un ennemi en etat avant son entree en combat
+func prepareEnemy(e *Enemy) {
+    e.HP = e.MaxHP
+    if e.CritTimer <= 0 {
+        e.CritTimer = 3
+    }
+    e.SilenceTurns = 0
+}
+
 // Verifie si toute l'equipe est KO
 func allAlliesDown(party []*Character) bool {
     for _, c := range party {
@@ -2050,35 +7011,113 @@ func targetAlive(rng *rand.Rand, party []*Character) *Character {
 
 // Gestion des combats de groupe
 func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []Enemy, opts battleOptions) bool {
+    g.region = opts.region()
+    g.observed = map[string]bool{}
     for _, ch := range party {
         ch.resetCombatFlags()
-        ch.reviveIfNeeded()
+        g.reviveIfNeeded(ch)
+        ch.applySetOpeners()
     }
     for i := range enemies {
-        enemies[i].HP = enemies[i].MaxHP
-        if enemies[i].CritTimer <= 0 {
-            enemies[i].CritTimer = 3
-        }
-        enemies[i].SilenceTurns = 0
+        prepareEnemy(&enemies[i])
+        g.scaleEnemy(&enemies[i])
+        g.noteEncounter(enemies[i])
     }
     for _, line := range opts.Intro {
         fmt.Println("[INFO]", line)
     }
-    round := 1
+    maxOnField := opts.MaxOnField
+    if maxOnField <= 0 {
+        maxOnField = 4
+    }
+    tier := 1
+    var slip *betSlip
+    if opts.AllowBet {
+        placed, abort := g.placeBets(reader, party, enemies)
+        if abort {
+            g.consumeMenuReturn()
+            fmt.Println("Retour au menu principal.")
+            return false
+        }
+        if placed != nil {
+            slip = placed
+            tier = slip.Tier
+        }
+    }
+    // Un combat quitte ou fui compte comme un pari perdu
+    settled := false
+    defer func() {
+        if !settled {
+            g.settleBets(slip, battleOutcome{})
+        }
+        g.noteBattle()
+        g.checkAchievements()
+    }()
+    finisher, allyKO := "", false
+    var pending []Enemy
+    bonusXP, bonusGold, extraKills := 0, 0, 0
+    // Fait entrer les renforts en attente tant qu'il reste de la place
+    deploy := func() {
+        for len(pending) > 0 && aliveEnemies(enemies) < maxOnField {
+            foe := pending[0]
+            pending = pending[1:]
+            prepareEnemy(&foe)
+            g.scaleEnemy(&foe)
+            scaleForBet(&foe, tier)
+            enemies = append(enemies, foe)
+            fmt.Printf("%d) %s entre dans le combat !\n", len(enemies), foe.Name)
+            g.noteEncounter(foe)
+        }
+    }
+    round, called := 1, 0
     for {
+        for _, wave := range opts.Reinforcements {
+            if wave.Round != round || called >= round {
+                continue
+            }
+            if wave.Call != "" {
+                fmt.Println("[RENFORT]", wave.Call)
+            }
+            pending = append(pending, wave.Enemies...)
+            bonusXP += wave.RewardXP * len(wave.Enemies)
+            bonusGold += wave.RewardGold * len(wave.Enemies)
+            extraKills += len(wave.Enemies)
+        }
+        called = round
+        deploy()
         if allEnemiesDown(enemies) {
             fmt.Println("Victoire du groupe !")
-            if opts.RewardXP > 0 {
+            xpGain := g.scaleReward((opts.RewardXP + bonusXP) * tier)
+            goldGain := g.scaleReward((opts.RewardGold + bonusGold) * tier)
+            if xpGain > 0 {
                 for _, ch := range party {
-                    ch.gainXP(opts.RewardXP)
+                    ch.gainXP(ch.traitXP(xpGain))
                 }
+                g.shareBenchXP(party, xpGain)
+            }
+            goldGain += traitGoldBonus(party, goldGain)
+            if goldGain > 0 {
+                g.Gold += goldGain
             }
-            if opts.RewardGold > 0 {
-                g.Gold += opts.RewardGold
+            if extraKills > 0 {
+                fmt.Printf("Renforts vaincus: %d (+%d or | +%d XP)\n", extraKills, bonusGold, bonusXP)
             }
-            if opts.RewardGold > 0 || opts.RewardXP > 0 {
-                fmt.Printf("Recompenses: +%d or | +%d XP par allie\n", opts.RewardGold, opts.RewardXP)
+            if goldGain > 0 || xpGain > 0 {
+                fmt.Printf("Recompenses: +%d or | +%d XP par allie\n", goldGain, xpGain)
             }
+            g.grantLoot(reader, g.lootReceiver(party), enemies)
+            if opts.RewardBetPts > 0 {
+                g.active().BetPts += opts.RewardBetPts * tier
+                fmt.Printf("Points de mise bonus: +%d.\n", opts.RewardBetPts*tier)
+            }
+            settled = true
+            g.settleBets(slip, battleOutcome{Won: true, Turns: round, AllyKO: allyKO, Finisher: finisher})
+            g.gainFame(g.region, victoryFame(opts))
+            g.Wins++
+            g.lastAllyKO = allyKO
+            g.noteDefeats(enemies)
+            g.questKills(enemies)
+            g.shareVictory(party)
             for _, line := range opts.Victory {
                 fmt.Println(line)
             }
@@ -2086,18 +7125,23 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
         }
         if allAlliesDown(party) {
             fmt.Println("L'equipe tombe !")
+            settled = true
+            g.settleBets(slip, battleOutcome{Turns: round, AllyKO: true})
+            g.lastAllyKO = true
             for _, ch := range party {
-                ch.reviveIfNeeded()
+                g.reviveIfNeeded(ch)
             }
+            g.checkIronmanWipe(enemies[0].Name)
             for _, line := range opts.Defeat {
                 fmt.Println(line)
             }
             return false
         }
+        g.checkpoint()
         showPartyHud(party, enemies)
         fmt.Printf("Tour %d\n", round)
         for _, ch := range party {
-            if ch.HP <= 0 {
+            if ch.HP <= 0 || allEnemiesDown(enemies) {
                 continue
             }
             for {
@@ -2109,12 +7153,12 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                 hasNyan := ch.Name == "Hatsune Miku"
                 fmt.Println("1) Attaquer")
                 if ch.HasNoteSpell {
-                    fmt.Println("2) Note explosive")
+                    fmt.Printf("2) Note explosive (%d MP)\n", ch.noteCost())
                 } else {
                     fmt.Println("2) Note explosive (verrouille)")
                 }
                 if hasNyan {
-                    fmt.Println("3) Attaque Nyan Cat")
+                    fmt.Printf("3) Attaque Nyan Cat (%d MP)\n", ch.nyanCost())
                     fmt.Println("4) Capacite speciale")
                     fmt.Println("5) Inventaire")
                     fmt.Println("6) Observer")
@@ -2137,18 +7181,20 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                 }
                 consumeTurn := true
                 handled := true
+                lastAction := ""
 
                 switch action {
                 case "1":
-                    target, abort := selectEnemy(reader, enemies)
+                    targets, abort := g.resolveTargets(reader, attackTarget, ch, party, enemies)
                     if abort {
                         fmt.Println("Retour au menu principal.")
                         return false
                     }
-                    if target == nil {
+                    if targets.empty() {
                         handled = false
                         consumeTurn = false
                     } else {
+                        target := targets.Enemies[0]
                         dmg := baseAttack(ch) + g.rng.Intn(5)
                         if ch.BattleBoost > 0 {
                             dmg *= ch.BattleBoost
@@ -2157,29 +7203,32 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                             dmg += 6
                             ch.IgnoreGuard = false
                         }
+                        dmg = g.gearCrit(ch, dmg)
                         target.HP -= dmg
                         if target.HP < 0 {
                             target.HP = 0
                         }
                         fmt.Printf("%s frappe %s pour %d degats.\n", ch.Name, target.Name, dmg)
+                        ch.gearOnHit(target)
                     }
                 case "2":
-                    if !ch.HasNoteSpell || ch.Mana < 10 {
+                    if !ch.HasNoteSpell || ch.Mana < ch.noteCost() {
                         fmt.Println("Sort indisponible.")
                         handled = false
                         consumeTurn = false
                     } else {
-                        target, abort := selectEnemy(reader, enemies)
+                        targets, abort := g.resolveTargets(reader, noteTarget, ch, party, enemies)
                         if abort {
                             fmt.Println("Retour au menu principal.")
                             return false
                         }
-                        if target == nil {
+                        if targets.empty() {
                             handled = false
                             consumeTurn = false
                         } else {
-                            ch.Mana -= 10
-                            dmg := 18 + g.rng.Intn(7)
+                            target := targets.Enemies[0]
+                            ch.Mana -= ch.noteCost()
+                            dmg := 18 + g.rng.Intn(7) + ch.skillBonus().NoteDamage
                             if ch.BattleBoost > 0 {
                                 dmg *= ch.BattleBoost
                             }
@@ -2196,22 +7245,23 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                     }
                 case "3":
                     if hasNyan {
-                        if ch.Mana < 16 {
+                        if ch.Mana < ch.nyanCost() {
                             fmt.Println("Pas assez de mana pour invoquer Nyan Cat.")
                             handled = false
                             consumeTurn = false
                         } else {
-                            target, abort := selectEnemy(reader, enemies)
+                            targets, abort := g.resolveTargets(reader, nyanTarget, ch, party, enemies)
                             if abort {
                                 fmt.Println("Retour au menu principal.")
                                 return false
                             }
-                            if target == nil {
+                            if targets.empty() {
                                 handled = false
                                 consumeTurn = false
                             } else {
-                                ch.Mana -= 16
-                                dmg := 26 + g.rng.Intn(8)
+                                target := targets.Enemies[0]
+                                ch.Mana -= ch.nyanCost()
+                                dmg := 26 + g.rng.Intn(8) + ch.skillBonus().NyanDamage
                                 if ch.BattleBoost > 0 {
                                     dmg *= ch.BattleBoost
                                 }
@@ -2224,6 +7274,7 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                                     target.HP = 0
                                 }
                                 fmt.Printf("Nyan Cat dechire la scene et inflige %d degats a %s !\n", dmg, target.Name)
+                                lastAction = sideBetNyan
                             }
                         }
                     } else {
@@ -2232,22 +7283,16 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                             handled = false
                             consumeTurn = false
                         } else {
-                            idx := firstAliveEnemy(enemies)
-                            if idx == -1 {
+                            used, consume := g.performSpecial(reader, ch, party, enemies)
+                            if g.consumeMenuReturn() {
+                                fmt.Println("Retour au menu principal.")
+                                return false
+                            }
+                            if !used {
                                 handled = false
                                 consumeTurn = false
-                            } else {
-                                used, consume := g.performSpecial(reader, ch, &enemies[idx], party)
-                                if g.consumeMenuReturn() {
-                                    fmt.Println("Retour au menu principal.")
-                                    return false
-                                }
-                                if !used {
-                                    handled = false
-                                    consumeTurn = false
-                                } else if !consume {
-                                    consumeTurn = false
-                                }
+                            } else if !consume {
+                                consumeTurn = false
                             }
                         }
                     }
@@ -2258,26 +7303,20 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                             handled = false
                             consumeTurn = false
                         } else {
-                            idx := firstAliveEnemy(enemies)
-                            if idx == -1 {
+                            used, consume := g.performSpecial(reader, ch, party, enemies)
+                            if g.consumeMenuReturn() {
+                                fmt.Println("Retour au menu principal.")
+                                return false
+                            }
+                            if !used {
                                 handled = false
                                 consumeTurn = false
-                            } else {
-                                used, consume := g.performSpecial(reader, ch, &enemies[idx], party)
-                                if g.consumeMenuReturn() {
-                                    fmt.Println("Retour au menu principal.")
-                                    return false
-                                }
-                                if !used {
-                                    handled = false
-                                    consumeTurn = false
-                                } else if !consume {
-                                    consumeTurn = false
-                                }
+                            } else if !consume {
+                                consumeTurn = false
                             }
                         }
                     } else {
-                        if !g.useInventory(reader, ch, nil, enemies) {
+                        if !g.useInventory(reader, ch, party, enemies, !g.StashSealed) {
                             handled = false
                             consumeTurn = false
                         }
@@ -2288,7 +7327,7 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                     }
                 case "5":
                     if hasNyan {
-                        if !g.useInventory(reader, ch, nil, enemies) {
+                        if !g.useInventory(reader, ch, party, enemies, !g.StashSealed) {
                             handled = false
                             consumeTurn = false
                         }
@@ -2297,12 +7336,12 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                             return false
                         }
                     } else {
-                        printEnemies(enemies)
+                        g.observeAll(enemies)
                         consumeTurn = false
                     }
                 case "6":
                     if hasNyan {
-                        printEnemies(enemies)
+                        g.observeAll(enemies)
                         consumeTurn = false
                     } else if opts.AllowEscape {
                         fmt.Println("Vous battez en retraite.")
@@ -2332,6 +7371,9 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                     consumeTurn = false
                 }
 
+                if allEnemiesDown(enemies) {
+                    finisher = lastAction
+                }
                 if !handled {
                     continue
                 }
@@ -2359,6 +7401,7 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                 fmt.Printf("%s souffre du poison (-%d).\n", enemy.Name, enemy.PoisonDmg)
                 enemy.PoisonTurns--
                 if enemy.HP <= 0 {
+                    finisher = ""
                     continue
                 }
             }
@@ -2384,7 +7427,7 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
             }
             if enemy.CritTimer <= 1 {
                 dmg *= 2
-                enemy.CritTimer = 3
+                enemy.CritTimer = enemy.CritEvery
                 fmt.Printf("%s declenche un critique !\n", enemy.Name)
             } else {
                 enemy.CritTimer--
@@ -2394,7 +7437,10 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                 target.DodgeNext = false
                 continue
             }
-            dmg = absorbShieldDamage(target, dmg)
+            if g.traitDodges(target) {
+                continue
+            }
+            dmg = absorbShieldDamage(target, target.traitGuard(dmg))
             if dmg <= 0 {
                 continue
             }
@@ -2403,7 +7449,12 @@ func (g *Game) fightParty(reader *bufio.Reader, party []*Character, enemies []En
                 target.HP = 0
             }
             fmt.Printf("%s inflige %d degats a %s.\n", enemy.Name, dmg, target.Name)
+            target.traitReflect(enemy, dmg)
+            if target.HP <= 0 {
+                allyKO = true
+            }
         }
+        endTurnTraits(party)
         round++
     }
 }
@@ -2481,10 +7532,15 @@ func (g *Game) battlePause(reader *bufio.Reader) string {
 // Session d'entrainement pour ameliorer l'equipe
 func (g *Game) training(reader *bufio.Reader) {
     fmt.Println("\n=== Entrainement ===")
+    region, ok := g.pickVenue(reader)
+    if !ok {
+        return
+    }
     hp := g.TrainingBaseHP + g.TrainingLevel*6
     atk := g.TrainingBaseAtk + g.TrainingLevel/2
     enemy := Enemy{Name: "Hater d'entrainement", Type: enemyHater, MaxHP: hp, HP: hp, Attack: atk, CritTimer: 3, Style: "Troll"}
     if g.fightSolo(reader, enemy, battleOptions{
+        Region:       region,
         AllowBet:     true,
         Intro:        []string{"Un hater veut tester ta concentration."},
         Victory:      []string{"Ton souffle gagne en puissance."},
@@ -2497,24 +7553,60 @@ func (g *Game) training(reader *bufio.Reader) {
         g.TrainingBaseHP += 2
         g.TrainingBaseAtk++
         active := g.active()
-        active.MaxHP += 5
+        active.BaseMaxHP += 5
+        active.refreshStats()
         active.HP += 5
         if active.HP > active.MaxHP {
             active.HP = active.MaxHP
         }
         fmt.Printf("%s gagne en endurance (HP max %d).\n", active.Name, active.MaxHP)
-        g.rewardMaterial(active)
         g.autoSave()
     }
 }
 
+// Choix de la region ou jouer un combat libre: Neonopolis, ou toute region ou Miku a encore des fans
+func (g *Game) pickVenue(reader *bufio.Reader) (string, bool) {
+    var venues []string
+    for _, region := range regionOrder {
+        if region == regionNeonopolis || g.Fame[region].Fame > 0 {
+            venues = append(venues, region)
+        }
+    }
+    if len(venues) == 1 {
+        return venues[0], true
+    }
+    fmt.Println("Ou se produire ?")
+    for i, region := range venues {
+        fmt.Printf("%d) %s (renommee %d/%d)\n", i+1, regionNames[region], g.Fame[region].Fame, fameMax)
+    }
+    fmt.Println("0) Retour")
+    fmt.Print("Choix: ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() {
+        return "", false
+    }
+    if err != nil || choice < 0 || choice > len(venues) {
+        fmt.Println("Choix invalide.")
+        return "", false
+    }
+    if choice == 0 {
+        return "", false
+    }
+    return venues[choice-1], true
+}
+
 // Combat de farm pour recolter or et XP
 func (g *Game) farm(reader *bufio.Reader) {
     fmt.Println("\n=== Farm d'EXP ===")
+    region, ok := g.pickVenue(reader)
+    if !ok {
+        return
+    }
     hp := 70 + g.FarmLevel*12
     atk := 8 + g.FarmLevel
     enemy := Enemy{Name: "Gardien repetitif", Type: enemyFarm, MaxHP: hp, HP: hp, Attack: atk, CritTimer: 3, Style: "Loop"}
     if g.fightSolo(reader, enemy, battleOptions{
+        Region:      region,
         AllowEscape: true,
         Intro:       []string{"Un adversaire sans histoire te barre la route."},
         Victory:     []string{"Tu grappilles quelques fans et materiaux."},
@@ -2522,14 +7614,19 @@ func (g *Game) farm(reader *bufio.Reader) {
         RewardGold:  3,
     }) {
         g.FarmLevel++
-        g.rewardMaterial(g.active())
         fmt.Println("Les adversaires de farm deviennent plus coriaces." )
         g.autoSave()
     }
 }
 
+// Reglages choisis a la creation d'un profil
+type profileSetup struct {
+    Difficulty string
+    Ironman    bool
+}
+
 // Choix ou creation d'un profil de sauvegarde
-func promptProfile(sm *SaveManager, reader *bufio.Reader) (string, *SaveState) {
+func promptProfile(sm *SaveManager, reader *bufio.Reader) (string, *SaveState, profileSetup) {
     for {
         profiles, err := sm.list()
         if err != nil {
@@ -2543,14 +7640,27 @@ func promptProfile(sm *SaveManager, reader *bufio.Reader) (string, *SaveState) {
                 fmt.Println("Nom vide.")
                 continue
             }
-            return name, nil
+            return name, nil, promptSetup(reader)
         }
         for i, name := range profiles {
-            fmt.Printf("%d) %s\n", i+1, name)
+            tag := ""
+            if state, err := sm.load(name); err == nil && state.Ironman {
+                tag = " [ironman]"
+                if state.Locked {
+                    tag = " [ironman termine]"
+                }
+            }
+            fmt.Printf("%d) %s%s\n", i+1, name, tag)
         }
         fmt.Println("0) Creer un nouveau profil")
+        fmt.Println("H) Hall of fame ironman")
         fmt.Print("Choix: ")
-        choice, err := strconv.Atoi(read(reader))
+        input := read(reader)
+        if strings.EqualFold(input, "h") {
+            showHallOfFame(sm)
+            continue
+        }
+        choice, err := strconv.Atoi(input)
         if err != nil || choice < 0 || choice > len(profiles) {
             fmt.Println("Choix invalide.")
             continue
@@ -2562,7 +7672,11 @@ func promptProfile(sm *SaveManager, reader *bufio.Reader) (string, *SaveState) {
                 fmt.Println("Nom vide.")
                 continue
             }
-            return name, nil
+            if existing, err := sm.load(name); err == nil && existing.Ironman {
+                fmt.Println("Ce nom appartient a une course ironman: une seule sauvegarde est permise.")
+                continue
+            }
+            return name, nil, promptSetup(reader)
         }
         name := profiles[choice-1]
         state, err := sm.load(name)
@@ -2570,8 +7684,308 @@ func promptProfile(sm *SaveManager, reader *bufio.Reader) (string, *SaveState) {
             fmt.Println("Lecture impossible:", err)
             continue
         }
+        if state.Locked {
+            fmt.Println("Cette course ironman est terminee. Retrouvez-la dans le hall of fame.")
+            continue
+        }
         fmt.Printf("Profil '%s' charge (derniere sauvegarde %s).\n", name, state.Timestamp.Format(time.RFC1123))
-        return name, state
+        return name, state, profileSetup{Difficulty: state.Difficulty, Ironman: state.Ironman}
+    }
+}
+
+// Demande les reglages d'un nouveau profil
+func promptSetup(reader *bufio.Reader) profileSetup {
+    setup := profileSetup{Difficulty: promptDifficulty(reader)}
+    fmt.Println("Mode ironman ? Une seule sauvegarde automatique, pas de releve par les fans, et une equipe decimee met fin a la course.")
+    fmt.Print("Activer (o/N): ")
+    setup.Ironman = strings.EqualFold(read(reader), "o")
+    return setup
+}
+
+// Demande la difficulte d'un nouveau profil
+func promptDifficulty(reader *bufio.Reader) string {
+    for {
+        fmt.Println("Choisis ta difficulte:")
+        for i, d := range difficulties {
+            fmt.Printf("%d) %s\n", i+1, describeDifficulty(d))
+        }
+        fmt.Print("Choix [2]: ")
+        input := read(reader)
+        if input == "" {
+            return difficultyNormal
+        }
+        choice, err := strconv.Atoi(input)
+        if err == nil && choice >= 1 && choice <= len(difficulties) {
+            return difficulties[choice-1].ID
+        }
+        fmt.Println("Choix invalide.")
+    }
+}
+
+// Resume les effets d'une difficulte
+func describeDifficulty(d difficultySettings) string {
+    revive := fmt.Sprintf("fans relevent a %d%% HP", int(d.ReviveRatio*100))
+    if d.ReviveRatio <= 0 {
+        revive = "fans relevent a 1 HP"
+    }
+    crit := "critiques a la cadence de chaque ennemi"
+    if d.CritShift > 0 {
+        crit = fmt.Sprintf("critiques %d tour(s) plus tard", d.CritShift)
+    } else if d.CritShift < 0 {
+        crit = fmt.Sprintf("critiques %d tour(s) plus tot", -d.CritShift)
+    }
+    return fmt.Sprintf("%s - ennemis HP x%.2f ATK x%.2f, %s, recompenses x%.2f, prix x%.2f, %s", d.Name, d.EnemyHP, d.EnemyAttack, crit, d.Rewards, d.Prices, revive)
+}
+
+// Permet de baisser la difficulte du profil (jamais de la remonter)
+func (g *Game) lowerDifficulty(reader *bufio.Reader) {
+    current := difficultyRank(g.Difficulty)
+    fmt.Printf("\n=== Difficulte ===\nActuelle: %s\n", describeDifficulty(difficulties[current]))
+    if current == 0 {
+        fmt.Println("Vous jouez deja au niveau le plus doux.")
+        return
+    }
+    for i := 0; i < current; i++ {
+        fmt.Printf("%d) %s\n", i+1, describeDifficulty(difficulties[i]))
+    }
+    fmt.Println("Attention: une difficulte abaissee ne pourra plus etre remontee.")
+    fmt.Print("Choix (0 annuler): ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() {
+        return
+    }
+    if err != nil || choice <= 0 || choice > current {
+        fmt.Println("Aucun changement.")
+        return
+    }
+    g.Difficulty = difficulties[choice-1].ID
+    fmt.Printf("Difficulte passee en %s.\n", g.difficulty().Name)
+    g.autoSave()
+}
+
+// Ecran de statistiques du personnage actif
+func (g *Game) statsScreen(reader *bufio.Reader) {
+    active := g.active()
+    for {
+        active.printStats()
+        g.printBetLedger()
+        fmt.Println("1) Sacoche")
+        fmt.Println("2) Equiper")
+        fmt.Println("3) Desequiper")
+        fmt.Printf("4) Competences (%d point(s))\n", active.SkillPoints)
+        fmt.Println("5) Offrir un cadeau a un allie")
+        fmt.Println("6) Traits")
+        fmt.Println("0) Retour")
+        fmt.Print("Choix: ")
+        choice := read(reader)
+        if g.consumeMenuReturn() {
+            return
+        }
+        switch choice {
+        case "1":
+            g.bagScreen(reader, active)
+        case "2":
+            g.equipMenu(reader, active)
+        case "3":
+            g.unequipMenu(reader, active)
+        case "4":
+            g.skillMenu(reader, active)
+        case "5":
+            g.giftMenu(reader)
+        case "6":
+            g.traitMenu(reader, active)
+        case "0", "":
+            return
+        default:
+            fmt.Println("Choix invalide.")
+        }
+    }
+}
+
+// Liste les pieces d'equipement de la sacoche et equipe celle choisie
+func (g *Game) equipMenu(reader *bufio.Reader, c *Character) {
+    gear := c.Inventory.filter(itemEquipment)
+    if len(gear) == 0 {
+        fmt.Println("Aucun equipement dans la sacoche.")
+        return
+    }
+    fmt.Println("\n=== Equiper ===")
+    for i, idx := range gear {
+        st := c.Inventory[idx]
+        def := items[st.ID]
+        worn := "libre"
+        if cur, ok := c.Equipment[def.Slot]; ok {
+            worn = "remplace " + stackLabel(cur)
+        }
+        if set := setOf(st.ID); set != "" {
+            worn += ", ensemble " + set
+        }
+        fmt.Printf("%d) %s [%s] - %s (%s)\n", i+1, stackLabel(st), slotNames[def.Slot], gearBonusLabel(st), worn)
+    }
+    fmt.Print("Choix (0 annuler): ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() || err != nil || choice <= 0 || choice > len(gear) {
+        return
+    }
+    c.equip(gear[choice-1])
+}
+
+// Propose les emplacements occupes et retire la piece choisie
+func (g *Game) unequipMenu(reader *bufio.Reader, c *Character) {
+    if len(c.Equipment) == 0 {
+        fmt.Println("Rien n'est equipe.")
+        return
+    }
+    c.printEquipment()
+    fmt.Print("Emplacement (0 annuler): ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() || err != nil || choice <= 0 || choice > len(equipSlots) {
+        return
+    }
+    c.unequip(equipSlots[choice-1])
+}
+
+// Demande une quantite entre 1 et max (max par defaut)
+func (g *Game) askQuantity(reader *bufio.Reader, max int) int {
+    if max <= 1 {
+        return max
+    }
+    fmt.Printf("Quantite (1-%d) [%d]: ", max, max)
+    input := read(reader)
+    if g.consumeMenuReturn() {
+        return 0
+    }
+    if input == "" {
+        return max
+    }
+    qty, err := strconv.Atoi(input)
+    if err != nil || qty < 1 || qty > max {
+        fmt.Println("Quantite invalide.")
+        return 0
+    }
+    return qty
+}
+
+// Choisit une pile dans une sacoche (indice -1 si annule)
+func (g *Game) pickStack(reader *bufio.Reader, title string, bag Inventory) int {
+    if len(bag) == 0 {
+        fmt.Println("Rien a deplacer.")
+        return -1
+    }
+    fmt.Println(title)
+    for i, st := range bag {
+        fmt.Printf("%d) %s\n", i+1, stackLabel(st))
+    }
+    fmt.Print("Choix (0 annuler): ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() || err != nil || choice <= 0 || choice > len(bag) {
+        return -1
+    }
+    return choice - 1
+}
+
+// Choisit un membre recrute de l'equipe
+func (g *Game) pickMember(reader *bufio.Reader, prompt string) *Character {
+    party := g.party()
+    for i, ch := range party {
+        fmt.Printf("%d) %s (%d/%d)\n", i+1, ch.Name, len(ch.Inventory), ch.InventoryMax)
+    }
+    fmt.Print(prompt + " (0 annuler): ")
+    choice, err := strconv.Atoi(read(reader))
+    if g.consumeMenuReturn() || err != nil || choice <= 0 || choice > len(party) {
+        return nil
+    }
+    return party[choice-1]
+}
+
+// Deplace des exemplaires d'une pile vers une autre sacoche si la place le permet
+func (g *Game) moveStack(reader *bufio.Reader, from *Inventory, idx int, to *Inventory, slots int) bool {
+    st := (*from)[idx]
+    qty := g.askQuantity(reader, st.Qty)
+    if qty <= 0 {
+        return false
+    }
+    moved := st
+    moved.Qty = qty
+    if !to.fits(moved, slots) {
+        fmt.Println("Pas assez de place a l'arrivee.")
+        return false
+    }
+    to.put(from.takeQty(idx, qty))
+    fmt.Printf("%s deplace.\n", stackLabel(moved))
+    return true
+}
+
+// Nombre de piles que peut contenir le coffre d'equipe
+const stashMax = 30
+
+// Coffre partage de l'equipe et echanges entre membres
+func (g *Game) stashScreen(reader *bufio.Reader) {
+    for {
+        fmt.Printf("\n=== Coffre d'equipe (%d/%d) ===\n", len(g.Stash), stashMax)
+        if len(g.Stash) == 0 {
+            fmt.Println("(vide)")
+        }
+        for _, st := range g.Stash {
+            fmt.Printf("- %s\n", stackLabel(st))
+        }
+        fmt.Println("1) Deposer un objet")
+        fmt.Println("2) Retirer un objet")
+        fmt.Println("3) Donner un objet a un autre membre")
+        if g.StashSealed {
+            fmt.Println("4) Puiser dans le coffre en combat de groupe: non")
+        } else {
+            fmt.Println("4) Puiser dans le coffre en combat de groupe: oui")
+        }
+        fmt.Println("0) Retour")
+        fmt.Print("Choix: ")
+        choice := read(reader)
+        if g.consumeMenuReturn() {
+            return
+        }
+        switch choice {
+        case "1":
+            member := g.pickMember(reader, "Qui depose")
+            if member == nil {
+                continue
+            }
+            if idx := g.pickStack(reader, "Sacoche de "+member.Name+":", member.Inventory); idx >= 0 {
+                g.moveStack(reader, &member.Inventory, idx, &g.Stash, stashMax)
+            }
+        case "2":
+            idx := g.pickStack(reader, "Contenu du coffre:", g.Stash)
+            if idx < 0 {
+                continue
+            }
+            if member := g.pickMember(reader, "Pour qui"); member != nil {
+                g.moveStack(reader, &g.Stash, idx, &member.Inventory, member.InventoryMax)
+            }
+        case "3":
+            giver := g.pickMember(reader, "Qui donne")
+            if giver == nil {
+                continue
+            }
+            idx := g.pickStack(reader, "Sacoche de "+giver.Name+":", giver.Inventory)
+            if idx < 0 {
+                continue
+            }
+            receiver := g.pickMember(reader, "Qui recoit")
+            if receiver == nil || receiver == giver {
+                continue
+            }
+            g.moveStack(reader, &giver.Inventory, idx, &receiver.Inventory, receiver.InventoryMax)
+        case "4":
+            g.StashSealed = !g.StashSealed
+            if g.StashSealed {
+                fmt.Println("Le coffre reste ferme pendant les combats de groupe.")
+            } else {
+                fmt.Println("Les allies pourront puiser dans le coffre en combat de groupe.")
+            }
+        case "0", "":
+            return
+        default:
+            fmt.Println("Choix invalide.")
+        }
     }
 }
 
@@ -2583,7 +7997,11 @@ func (g *Game) chooseCharacter(reader *bufio.Reader) {
         if !ch.Unlocked {
             status = "verrouille"
         }
-        fmt.Printf("%d) %s [%s]\n", i+1, ch.Name, status)
+        hearts := ""
+        if ch.Name != "Hatsune Miku" {
+            hearts = " " + ch.hearts()
+        }
+        fmt.Printf("%d) %s [%s]%s\n", i+1, ch.Name, status, hearts)
     }
     fmt.Print("Choix (0 annuler): ")
     choice, err := strconv.Atoi(read(reader))
@@ -2615,7 +8033,7 @@ func (g *Game) runNextStory(reader *bufio.Reader) {
     case stageLabel:
         g.labelFinal(reader)
     case stageFinish:
-        fmt.Println("L'histoire principale est terminee. Continuez a jouer librement !")
+        g.newGamePlus(reader)
     }
 }
 
@@ -2627,10 +8045,23 @@ func (g *Game) run(reader *bufio.Reader) {
     if g.StoryStage == stagePrologue {
         g.prologue(reader)
     }
+    g.updateQuests()
     for {
+        if g.Locked {
+            fmt.Println("Ce profil ironman est termine et verrouille.")
+            showHallOfFame(g.saver)
+            return
+        }
         banner("Menu principal")
         active := g.active()
-        fmt.Printf("Profil: %s | Or: %d | Perso: %s | Points de mise: %d\n", g.profile, g.Gold, active.Name, active.BetPts)
+        mode := g.difficulty().Name
+        if g.Ironman {
+            mode += " ironman"
+        }
+        if g.Cycle > 0 {
+            mode += fmt.Sprintf(" | NG+%d", g.Cycle)
+        }
+        fmt.Printf("Profil: %s | Difficulte: %s | Or: %d | Fans: %d | Perso: %s | Points de mise: %d\n", g.profile, mode, g.Gold, g.fans(), active.Name, active.BetPts)
         fmt.Println("1) Continuer l'histoire")
         fmt.Println("2) Entrainement")
         fmt.Println("3) Farm d'EXP")
@@ -2644,6 +8075,10 @@ func (g *Game) run(reader *bufio.Reader) {
         fmt.Println("7) Changer de personnage")
         fmt.Println("8) Sauvegarder")
         fmt.Println("9) Quitter")
+        fmt.Println("10) Difficulte")
+        fmt.Println("11) Coffre d'equipe")
+        fmt.Println("12) Carnets")
+        fmt.Println("13) Habitants et quetes annexes")
         fmt.Print("Choix: ")
         choice := read(reader)
         if g.consumeMenuReturn() {
@@ -2657,7 +8092,7 @@ func (g *Game) run(reader *bufio.Reader) {
         case "3":
             g.farm(reader)
         case "4":
-            active.printStats()
+            g.statsScreen(reader)
         case "5":
             g.handleMerchant(reader)
         case "6":
@@ -2665,14 +8100,29 @@ func (g *Game) run(reader *bufio.Reader) {
         case "7":
             g.chooseCharacter(reader)
         case "8":
-            g.autoSave()
+            if g.Ironman {
+                fmt.Println("Mode ironman: la sauvegarde est automatique apres chaque action.")
+            } else {
+                g.autoSave()
+            }
         case "9":
             g.autoSave()
             fmt.Println("Merci d'avoir defendu la musique libre !")
             return
+        case "10":
+            g.lowerDifficulty(reader)
+        case "11":
+            g.stashScreen(reader)
+        case "12":
+            g.notebooks(reader)
+        case "13":
+            g.townsfolk(reader)
         default:
             fmt.Println("Choix invalide.")
         }
+        g.updateQuests()
+        g.checkAchievements()
+        g.checkpoint()
     }
 }
 
@@ -2680,13 +8130,37 @@ func (g *Game) run(reader *bufio.Reader) {
 
 // Point d'entree du programme
 func main() {
+    if err := loadContent(contentDirName); err != nil {
+        fmt.Println("Fichiers de contenu invalides:")
+        fmt.Println(err)
+        os.Exit(1)
+    }
     reader := bufio.NewReader(os.Stdin)
     sm := newSaveManager(saveDirName)
-    profile, state := promptProfile(sm, reader)
+    profile, state, setup := promptProfile(sm, reader)
     game := newGame(sm, profile, state)
+    if state == nil {
+        game.Difficulty = setup.Difficulty
+        game.Ironman = setup.Ironman
+    }
     game.run(reader)
 }
 
+// Action Observer en groupe: etat des ennemis et notes de bestiaire
+func (g *Game) observeAll(enemies []Enemy) {
+    printEnemies(enemies)
+    fresh := false
+    for _, e := range enemies {
+        if e.HP > 0 && !g.observed[e.Name] {
+            g.observe(e)
+            fresh = true
+        }
+    }
+    if !fresh {
+        fmt.Println("Rien de nouveau a noter pendant ce combat.")
+    }
+}
+
 // Affiche l'etat des ennemis pendant un combat
 func printEnemies(enemies []Enemy) {
     for i, e := range enemies {
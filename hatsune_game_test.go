@@ -0,0 +1,100 @@
+package main
+
+import "testing"
+
+// Catalogue minimal pour les tests de sacoche (potion: piles de 3, gant: 1 par pile)
+func withTestItems(t *testing.T) {
+    saved := items
+    items = map[string]ItemDefinition{
+        "potion": {ID: "potion", Type: itemConsumable, StackMax: 3},
+        "glove":  {ID: "glove", Type: itemEquipment},
+    }
+    t.Cleanup(func() { items = saved })
+}
+
+func TestPutFillsStacksUpToLimit(t *testing.T) {
+    withTestItems(t)
+    var inv Inventory
+    inv.put(ItemStack{ID: "potion", Qty: 2})
+    inv.put(ItemStack{ID: "potion", Qty: 5})
+    if len(inv) != 3 || inv[0].Qty != 3 || inv[1].Qty != 3 || inv[2].Qty != 1 {
+        t.Fatalf("piles inattendues: %+v", inv)
+    }
+    if got := inv.count("potion"); got != 7 {
+        t.Fatalf("count = %d, attendu 7", got)
+    }
+}
+
+func TestPutKeepsInstancesApart(t *testing.T) {
+    withTestItems(t)
+    var inv Inventory
+    inv.put(ItemStack{ID: "potion", Qty: 1})
+    inv.put(ItemStack{ID: "potion", Qty: 1, Upgrade: 2})
+    inv.put(ItemStack{ID: "potion", Qty: 1, Rarity: rarityLegendary, Affixes: []Affix{{Kind: affixMaxHP, Value: 5}}})
+    inv.put(ItemStack{ID: "potion", Qty: 1, Rarity: rarityLegendary, Affixes: []Affix{{Kind: affixMaxHP, Value: 5}}})
+    if len(inv) != 4 {
+        t.Fatalf("les exemplaires ameliores ou tires ne doivent pas fusionner: %+v", inv)
+    }
+    if inv[1].Upgrade != 2 || len(inv[2].Affixes) != 1 {
+        t.Fatalf("niveau ou affixes perdus: %+v", inv)
+    }
+}
+
+func TestFitsCountsFreeRoomAndSlots(t *testing.T) {
+    withTestItems(t)
+    inv := Inventory{{ID: "potion", Qty: 2}, {ID: "glove", Qty: 1}}
+    if !inv.fits(ItemStack{ID: "potion", Qty: 1}, 2) {
+        t.Fatal("la pile entamee doit accueillir une potion")
+    }
+    if inv.fits(ItemStack{ID: "potion", Qty: 2}, 2) {
+        t.Fatal("deux potions ne tiennent pas sans emplacement libre")
+    }
+    if !inv.fits(ItemStack{ID: "potion", Qty: 4}, 3) {
+        t.Fatal("1 place dans la pile + 3 dans un nouvel emplacement")
+    }
+    if inv.fits(ItemStack{ID: "potion", Qty: 1, Upgrade: 1}, 2) {
+        t.Fatal("un exemplaire ameliore demande son propre emplacement")
+    }
+}
+
+func TestRemovePrefersBasicStacks(t *testing.T) {
+    withTestItems(t)
+    inv := Inventory{
+        {ID: "potion", Qty: 2},
+        {ID: "potion", Qty: 1, Upgrade: 3},
+        {ID: "potion", Qty: 1, Rarity: rarityEpic, Affixes: []Affix{{Kind: affixMaxMana, Value: 4}}},
+    }
+    if !inv.remove("potion", 2) {
+        t.Fatal("remove doit reussir")
+    }
+    if len(inv) != 2 || inv[0].Upgrade != 3 || inv[1].Rarity != rarityEpic {
+        t.Fatalf("les exemplaires de base doivent partir en premier: %+v", inv)
+    }
+    if !inv.remove("potion", 1) || inv.count("potion") != 1 {
+        t.Fatalf("sans exemplaire de base, remove puise dans les autres: %+v", inv)
+    }
+}
+
+func TestRemoveRefusesMissingQuantity(t *testing.T) {
+    withTestItems(t)
+    inv := Inventory{{ID: "potion", Qty: 2}}
+    if inv.remove("potion", 3) {
+        t.Fatal("remove ne doit pas reussir sans assez d'exemplaires")
+    }
+    if inv.count("potion") != 2 {
+        t.Fatalf("la sacoche ne doit pas changer: %+v", inv)
+    }
+}
+
+func TestTakeQtyKeepsInstance(t *testing.T) {
+    withTestItems(t)
+    inv := Inventory{{ID: "potion", Qty: 3, Upgrade: 1}, {ID: "glove", Qty: 1, Rarity: rarityRare}}
+    got := inv.takeQty(0, 2)
+    if got.Qty != 2 || got.Upgrade != 1 || inv[0].Qty != 1 {
+        t.Fatalf("takeQty partiel: pris %+v, reste %+v", got, inv)
+    }
+    got = inv.takeQty(1, 5)
+    if got.Qty != 1 || got.Rarity != rarityRare || len(inv) != 1 {
+        t.Fatalf("takeQty doit vider la pile et la retirer: pris %+v, reste %+v", got, inv)
+    }
+}